@@ -0,0 +1,119 @@
+package calico
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Adoption modes for objects that already exist when a resource is created.
+// In strict mode an existing object is only taken over when it matches the
+// config, in reconcile mode it's overwritten with the config.
+const (
+	adoptNever     = "never"
+	adoptStrict    = "strict"
+	adoptReconcile = "reconcile"
+)
+
+func validateAdoptExisting(allowEmpty bool) schema.SchemaValidateFunc {
+	return func(v interface{}, k string) (ws []string, es []error) {
+		switch v.(string) {
+		case adoptNever, adoptStrict, adoptReconcile:
+		case "":
+			if !allowEmpty {
+				es = append(es, fmt.Errorf("%s must be %q, %q or %q", k, adoptNever, adoptStrict, adoptReconcile))
+			}
+		default:
+			es = append(es, fmt.Errorf("%s must be %q, %q or %q, got %q", k, adoptNever, adoptStrict, adoptReconcile, v))
+		}
+		return
+	}
+}
+
+// adoptMode returns how the resource in d adopts existing objects, either by
+// itself or through the provider wide adopt_existing
+func (c config) adoptMode(d *schema.ResourceData) string {
+	mode := d.Get("adopt_existing").(string)
+	if mode == "" {
+		mode = c.adoptExisting
+	}
+
+	return mode
+}
+
+// adopt takes over an object that Create found in place. The metadata and
+// spec pairs are compared with what's configured. It returns whether the
+// configured object still has to be written.
+func (c config) adopt(d *schema.ResourceData, id string, existingMetadata, existingSpec, metadata, spec interface{}) (bool, error) {
+	diffs := append(diffObjects("metadata", existingMetadata, metadata), diffObjects("spec", existingSpec, spec)...)
+
+	if len(diffs) == 0 {
+		log.Printf("[INFO] adopting existing %s", id)
+		return false, nil
+	}
+
+	if c.adoptMode(d) == adoptStrict {
+		return false, fmt.Errorf("%s already exists and differs from config:\n  %s", id, strings.Join(diffs, "\n  "))
+	}
+
+	log.Printf("[INFO] adopting existing %s, reconciling:\n  %s", id, strings.Join(diffs, "\n  "))
+	return true, nil
+}
+
+// diffObjects lists the fields that differ between two API objects
+func diffObjects(path string, existing, desired interface{}) []string {
+	return diffValues(path, toGeneric(existing), toGeneric(desired))
+}
+
+// toGeneric converts an API object into the maps and slices of its JSON
+// representation
+func toGeneric(object interface{}) interface{} {
+	var generic interface{}
+
+	b, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Sprintf("%#v", object)
+	}
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return string(b)
+	}
+
+	return generic
+}
+
+func diffValues(path string, existing, desired interface{}) []string {
+	existingMap, existingOk := existing.(map[string]interface{})
+	desiredMap, desiredOk := desired.(map[string]interface{})
+
+	if existingOk && desiredOk {
+		keys := make([]string, 0, len(existingMap)+len(desiredMap))
+		for k := range existingMap {
+			keys = append(keys, k)
+		}
+		for k := range desiredMap {
+			if _, ok := existingMap[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		diffs := []string{}
+		for _, k := range keys {
+			diffs = append(diffs, diffValues(path+"."+k, existingMap[k], desiredMap[k])...)
+		}
+		return diffs
+	}
+
+	if reflect.DeepEqual(existing, desired) {
+		return nil
+	}
+
+	e, _ := json.Marshal(existing)
+	w, _ := json.Marshal(desired)
+	return []string{fmt.Sprintf("%s: %s in the datastore, %s in config", path, e, w)}
+}
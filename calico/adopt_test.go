@@ -0,0 +1,37 @@
+package calico
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffObjects(t *testing.T) {
+	type spec struct {
+		Selector string            `json:"selector,omitempty"`
+		Order    *float64          `json:"order,omitempty"`
+		Labels   map[string]string `json:"labels,omitempty"`
+	}
+	order, otherOrder := 100.0, 200.0
+
+	cases := []struct {
+		existing spec
+		desired  spec
+		expected []string
+	}{
+		{spec{Selector: "a", Order: &order}, spec{Selector: "a", Order: &order}, nil},
+		{spec{Selector: "a"}, spec{Selector: "b"}, []string{`spec.selector: "a" in the datastore, "b" in config`}},
+		{spec{Order: &order}, spec{Order: &otherOrder}, []string{`spec.order: 100 in the datastore, 200 in config`}},
+		{spec{Labels: map[string]string{"a": "1", "b": "2"}}, spec{Labels: map[string]string{"b": "3", "c": "4"}}, []string{
+			`spec.labels.a: "1" in the datastore, null in config`,
+			`spec.labels.b: "2" in the datastore, "3" in config`,
+			`spec.labels.c: null in the datastore, "4" in config`,
+		}},
+	}
+
+	for _, c := range cases {
+		diffs := diffObjects("spec", c.existing, c.desired)
+		if len(c.expected) == 0 && len(diffs) > 0 || len(c.expected) > 0 && !reflect.DeepEqual(diffs, c.expected) {
+			t.Errorf("diffObjects(%+v, %+v) = %q, expected %q", c.existing, c.desired, diffs, c.expected)
+		}
+	}
+}
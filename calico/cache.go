@@ -0,0 +1,346 @@
+package calico
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	"github.com/projectcalico/libcalico-go/lib/client"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+	"github.com/projectcalico/libcalico-go/lib/scope"
+)
+
+// readCache serves resource reads from a snapshot that is listed once per
+// kind, or once per node for host endpoints, instead of one Get per object.
+// Objects written by the provider are marked stale and are read with a Get
+// from then on. Callers get copies of the cached objects.
+type readCache struct {
+	mu    sync.Mutex
+	lists map[string]*cachedList
+}
+
+type cachedList struct {
+	sync.Mutex
+	objects map[string]cachedObject
+	stale   map[string]bool
+}
+
+type cachedObject struct {
+	object   interface{}
+	revision string
+}
+
+func newReadCache() *readCache {
+	return &readCache{
+		lists: make(map[string]*cachedList),
+	}
+}
+
+func (c *readCache) scope(scope string) *cachedList {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.lists[scope]
+	if !ok {
+		cached = &cachedList{
+			stale: make(map[string]bool),
+		}
+		c.lists[scope] = cached
+	}
+
+	return cached
+}
+
+// get returns object id from the snapshot of scope, calling list to take the
+// snapshot on first use and get for objects that were written since
+func (c *readCache) get(scope, id string, identifier interface{}, list func() (map[string]cachedObject, error), get func() (cachedObject, error)) (cachedObject, error) {
+	cached := c.scope(scope)
+
+	cached.Lock()
+	if cached.objects == nil {
+		log.Printf("[DEBUG] read cache: listing %s", scope)
+		objects, err := list()
+		if err != nil {
+			cached.Unlock()
+			return cachedObject{}, err
+		}
+		cached.objects = objects
+	}
+	object, found := cached.objects[id]
+	stale := cached.stale[id]
+	cached.Unlock()
+
+	if stale {
+		return get()
+	}
+	if !found {
+		return cachedObject{}, errors.ErrorResourceDoesNotExist{Identifier: identifier}
+	}
+
+	copied, err := copyObject(object.object)
+	if err != nil {
+		// never hand out the shared object, read this one from the datastore
+		log.Printf("[WARN] read cache: %v, reading %s from the datastore", err, id)
+		return get()
+	}
+
+	return cachedObject{copied, object.revision}, nil
+}
+
+// invalidate makes the next read of object id in scope go to the datastore
+func (c *readCache) invalidate(scope, id string) {
+	if c == nil {
+		return
+	}
+
+	cached := c.scope(scope)
+	cached.Lock()
+	cached.stale[id] = true
+	cached.Unlock()
+}
+
+func nodeCacheKey(metadata api.NodeMetadata) (string, string) {
+	return "nodes", metadata.Name
+}
+
+func hostEndpointCacheKey(metadata api.HostEndpointMetadata) (string, string) {
+	return "hostendpoints/" + metadata.Node, metadata.Name
+}
+
+func ipPoolCacheKey(metadata api.IPPoolMetadata) (string, string) {
+	return "ippools", metadata.CIDR.String()
+}
+
+func bgpPeerCacheKey(metadata api.BGPPeerMetadata) (string, string) {
+	return "bgppeers", fmt.Sprintf("%s/%s/%s", metadata.Scope, metadata.Node, metadata.PeerIP.String())
+}
+
+func policyCacheKey(metadata api.PolicyMetadata) (string, string) {
+	return "policies", metadata.Name
+}
+
+func profileCacheKey(metadata api.ProfileMetadata) (string, string) {
+	return "profiles", metadata.Name
+}
+
+// cachedKind describes how the objects of a kind are listed and read, the
+// list returns the API list type with its Items. key returns the datastore
+// key of a listed object, which its revision is found by.
+type cachedKind struct {
+	list func(calicoClient *client.Client) (interface{}, error)
+	get  func(calicoClient *client.Client) (interface{}, error)
+	id   func(object interface{}) string
+	key  func(object interface{}) model.Key
+}
+
+// read returns an object and its revision, from the read cache when enabled
+func (c config) read(scope, id string, identifier interface{}, kind cachedKind) (interface{}, string, error) {
+	get := func() (cachedObject, error) {
+		calicoClient, revisions := newRevisionClient(c.Client)
+		object, err := kind.get(calicoClient)
+		return cachedObject{object, revisions.seen()}, err
+	}
+	list := func() (map[string]cachedObject, error) {
+		calicoClient, revisions := newRevisionClient(c.Client)
+		list, err := kind.list(calicoClient)
+		if err != nil {
+			return nil, err
+		}
+		items := listItems(list)
+		objects := make(map[string]cachedObject, len(items))
+		for _, item := range items {
+			objects[kind.id(item)] = cachedObject{item, revisions.listedRevision(kind.key(item))}
+		}
+		return objects, nil
+	}
+
+	var object cachedObject
+	var err error
+	if c.cache == nil {
+		object, err = get()
+	} else {
+		object, err = c.cache.get(scope, id, identifier, list, get)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return object.object, object.revision, nil
+}
+
+// listItems returns pointers to the Items of an API list
+func listItems(list interface{}) []interface{} {
+	items := reflect.ValueOf(list).Elem().FieldByName("Items")
+	pointers := make([]interface{}, items.Len())
+	for i := range pointers {
+		pointers[i] = items.Index(i).Addr().Interface()
+	}
+	return pointers
+}
+
+// copyObject returns a deep copy of a pointer to an API object, so callers
+// can't change the objects in the cache
+func copyObject(object interface{}) (interface{}, error) {
+	copied := reflect.New(reflect.TypeOf(object).Elem())
+	b, err := json.Marshal(object)
+	if err == nil {
+		err = json.Unmarshal(b, copied.Interface())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't copy %T: %v", object, err)
+	}
+	return copied.Interface(), nil
+}
+
+func (c config) getNode(metadata api.NodeMetadata) (*api.Node, string, error) {
+	scope, id := nodeCacheKey(metadata)
+	object, revision, err := c.read(scope, id, metadata, cachedKind{
+		list: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.Nodes().List(api.NodeMetadata{})
+		},
+		get: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.Nodes().Get(metadata)
+		},
+		id: func(object interface{}) string {
+			_, id := nodeCacheKey(object.(*api.Node).Metadata)
+			return id
+		},
+		key: func(object interface{}) model.Key {
+			return model.NodeKey{Hostname: object.(*api.Node).Metadata.Name}
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return object.(*api.Node), revision, nil
+}
+
+func (c config) getHostEndpoint(metadata api.HostEndpointMetadata) (*api.HostEndpoint, string, error) {
+	scope, id := hostEndpointCacheKey(metadata)
+	object, revision, err := c.read(scope, id, metadata, cachedKind{
+		list: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.HostEndpoints().List(api.HostEndpointMetadata{Node: metadata.Node})
+		},
+		get: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.HostEndpoints().Get(metadata)
+		},
+		id: func(object interface{}) string {
+			_, id := hostEndpointCacheKey(object.(*api.HostEndpoint).Metadata)
+			return id
+		},
+		key: func(object interface{}) model.Key {
+			metadata := object.(*api.HostEndpoint).Metadata
+			return model.HostEndpointKey{Hostname: metadata.Node, EndpointID: metadata.Name}
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return object.(*api.HostEndpoint), revision, nil
+}
+
+func (c config) getIPPool(metadata api.IPPoolMetadata) (*api.IPPool, string, error) {
+	scope, id := ipPoolCacheKey(metadata)
+	object, revision, err := c.read(scope, id, metadata, cachedKind{
+		list: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.IPPools().List(api.IPPoolMetadata{})
+		},
+		get: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.IPPools().Get(metadata)
+		},
+		id: func(object interface{}) string {
+			_, id := ipPoolCacheKey(object.(*api.IPPool).Metadata)
+			return id
+		},
+		key: func(object interface{}) model.Key {
+			return model.IPPoolKey{CIDR: object.(*api.IPPool).Metadata.CIDR}
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return object.(*api.IPPool), revision, nil
+}
+
+func (c config) getBGPPeer(metadata api.BGPPeerMetadata) (*api.BGPPeer, string, error) {
+	cacheScope, id := bgpPeerCacheKey(metadata)
+	object, revision, err := c.read(cacheScope, id, metadata, cachedKind{
+		list: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.BGPPeers().List(api.BGPPeerMetadata{})
+		},
+		get: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.BGPPeers().Get(metadata)
+		},
+		id: func(object interface{}) string {
+			_, id := bgpPeerCacheKey(object.(*api.BGPPeer).Metadata)
+			return id
+		},
+		key: func(object interface{}) model.Key {
+			metadata := object.(*api.BGPPeer).Metadata
+			if metadata.Scope == scope.Global {
+				return model.GlobalBGPPeerKey{PeerIP: metadata.PeerIP}
+			}
+			return model.NodeBGPPeerKey{Nodename: metadata.Node, PeerIP: metadata.PeerIP}
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return object.(*api.BGPPeer), revision, nil
+}
+
+func (c config) getPolicy(metadata api.PolicyMetadata) (*api.Policy, string, error) {
+	scope, id := policyCacheKey(metadata)
+	object, revision, err := c.read(scope, id, metadata, cachedKind{
+		list: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.Policies().List(api.PolicyMetadata{})
+		},
+		get: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.Policies().Get(metadata)
+		},
+		id: func(object interface{}) string {
+			_, id := policyCacheKey(object.(*api.Policy).Metadata)
+			return id
+		},
+		key: func(object interface{}) model.Key {
+			return model.PolicyKey{Name: object.(*api.Policy).Metadata.Name}
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return object.(*api.Policy), revision, nil
+}
+
+func (c config) getProfile(metadata api.ProfileMetadata) (*api.Profile, string, error) {
+	scope, id := profileCacheKey(metadata)
+	object, revision, err := c.read(scope, id, metadata, cachedKind{
+		list: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.Profiles().List(api.ProfileMetadata{})
+		},
+		get: func(calicoClient *client.Client) (interface{}, error) {
+			return calicoClient.Profiles().Get(metadata)
+		},
+		id: func(object interface{}) string {
+			_, id := profileCacheKey(object.(*api.Profile).Metadata)
+			return id
+		},
+		key: func(object interface{}) model.Key {
+			return model.ProfileKey{Name: object.(*api.Profile).Metadata.Name}
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return object.(*api.Profile), revision, nil
+}
@@ -0,0 +1,144 @@
+package calico
+
+import (
+	"testing"
+
+	"github.com/projectcalico/libcalico-go/lib/errors"
+)
+
+type testCachedObject struct {
+	Name   string
+	Labels map[string]string
+}
+
+// testCacheSource counts the lists and gets the cache makes
+type testCacheSource struct {
+	objects map[string]*testCachedObject
+	lists   int
+	gets    int
+}
+
+func (s *testCacheSource) list() (map[string]cachedObject, error) {
+	s.lists++
+	objects := make(map[string]cachedObject)
+	for id, object := range s.objects {
+		objects[id] = cachedObject{object, "1"}
+	}
+	return objects, nil
+}
+
+func (s *testCacheSource) get(id string) func() (cachedObject, error) {
+	return func() (cachedObject, error) {
+		s.gets++
+		object, ok := s.objects[id]
+		if !ok {
+			return cachedObject{}, errors.ErrorResourceDoesNotExist{Identifier: id}
+		}
+		return cachedObject{object, "2"}, nil
+	}
+}
+
+func TestReadCache_hit(t *testing.T) {
+	source := &testCacheSource{objects: map[string]*testCachedObject{
+		"a": {Name: "a"},
+		"b": {Name: "b"},
+	}}
+	cache := newReadCache()
+
+	for _, id := range []string{"a", "b", "a"} {
+		object, err := cache.get("test", id, id, source.list, source.get(id))
+		if err != nil {
+			t.Fatalf("get %s: %v", id, err)
+		}
+		if name := object.object.(*testCachedObject).Name; name != id || object.revision != "1" {
+			t.Fatalf("get %s returned %s at revision %s", id, name, object.revision)
+		}
+	}
+	if source.lists != 1 || source.gets != 0 {
+		t.Fatalf("expected 1 list and no gets, got %d lists and %d gets", source.lists, source.gets)
+	}
+}
+
+func TestReadCache_invalidate(t *testing.T) {
+	source := &testCacheSource{objects: map[string]*testCachedObject{
+		"a": {Name: "a"},
+	}}
+	cache := newReadCache()
+
+	if _, err := cache.get("test", "a", "a", source.list, source.get("a")); err != nil {
+		t.Fatalf("get a: %v", err)
+	}
+	cache.invalidate("test", "a")
+	object, err := cache.get("test", "a", "a", source.list, source.get("a"))
+	if err != nil {
+		t.Fatalf("get a: %v", err)
+	}
+	if object.revision != "2" || source.lists != 1 || source.gets != 1 {
+		t.Fatalf("expected an invalidated object to be read with a get, got revision %s after %d lists and %d gets",
+			object.revision, source.lists, source.gets)
+	}
+
+	// a nil cache, when caching is disabled, ignores invalidations
+	var disabled *readCache
+	disabled.invalidate("test", "a")
+}
+
+func TestReadCache_notFound(t *testing.T) {
+	source := &testCacheSource{objects: map[string]*testCachedObject{}}
+	cache := newReadCache()
+
+	_, err := cache.get("test", "a", "a", source.list, source.get("a"))
+	if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
+		t.Fatalf("expected ErrorResourceDoesNotExist, got %v", err)
+	}
+
+	// objects written after the snapshot are found through a get
+	source.objects["a"] = &testCachedObject{Name: "a"}
+	cache.invalidate("test", "a")
+	if _, err := cache.get("test", "a", "a", source.list, source.get("a")); err != nil {
+		t.Fatalf("get a: %v", err)
+	}
+}
+
+func TestReadCache_copies(t *testing.T) {
+	source := &testCacheSource{objects: map[string]*testCachedObject{
+		"a": {Name: "a", Labels: map[string]string{"role": "worker"}},
+	}}
+	cache := newReadCache()
+
+	object, _ := cache.get("test", "a", "a", source.list, source.get("a"))
+	object.object.(*testCachedObject).Labels["role"] = "changed"
+
+	object, _ = cache.get("test", "a", "a", source.list, source.get("a"))
+	if role := object.object.(*testCachedObject).Labels["role"]; role != "worker" {
+		t.Fatalf("expected the cached object to be unchanged, got role %s", role)
+	}
+}
+
+// testUncopyableObject can't be copied through JSON
+type testUncopyableObject struct {
+	Name    string
+	Updates chan string
+}
+
+func TestReadCache_uncopyable(t *testing.T) {
+	shared := &testUncopyableObject{Name: "a"}
+	lists, gets := 0, 0
+	list := func() (map[string]cachedObject, error) {
+		lists++
+		return map[string]cachedObject{"a": {shared, "1"}}, nil
+	}
+	get := func() (cachedObject, error) {
+		gets++
+		return cachedObject{&testUncopyableObject{Name: "a"}, "2"}, nil
+	}
+	cache := newReadCache()
+
+	object, err := cache.get("test", "a", "a", list, get)
+	if err != nil {
+		t.Fatalf("get a: %v", err)
+	}
+	if object.object == shared || object.revision != "2" || gets != 1 {
+		t.Fatalf("expected an object that can't be copied to be read with a get, got revision %s after %d gets", object.revision, gets)
+	}
+}
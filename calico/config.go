@@ -1,18 +1,37 @@
 package calico
 
 import (
+	"net"
+
 	"github.com/projectcalico/libcalico-go/lib/api"
 	"github.com/projectcalico/libcalico-go/lib/client"
 )
 
 type config struct {
-	config api.CalicoAPIConfig
-	Client *client.Client
+	config  api.CalicoAPIConfig
+	Client  *client.Client
+	limiter *requestLimiter
+	cache   *readCache
+
+	updateMode    string
+	adoptExisting string
+	reservedCIDRs []net.IPNet
 }
 
 func (c *config) loadAndValidate() error {
 	calicoClient, err := client.New(c.config)
+	if err != nil {
+		return err
+	}
+
+	// every resource shares the same limiter through the client backend
+	if c.limiter != nil {
+		calicoClient.Backend = throttledBackend{
+			Client:  calicoClient.Backend,
+			limiter: c.limiter,
+		}
+	}
 	c.Client = calicoClient
 
-	return err
+	return nil
 }
@@ -0,0 +1,95 @@
+package calico
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+)
+
+func dataSourceCalicoIpamLeaks() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceCalicoIpamLeaksRead,
+
+		Schema: map[string]*schema.Schema{
+			"cidr": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateCIDR,
+			},
+			"leaks": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"handle": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"node": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"reason": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"addresses": &schema.Schema{
+							Type:     schema.TypeList,
+							Computed: true,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceCalicoIpamLeaksRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	cidr, err := dToOptionalCIDR(d, "cidr")
+	if err != nil {
+		return err
+	}
+	leaks, err := findIPAMLeaks(config.Client, cidr)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	leakMaps := make([]interface{}, len(leaks))
+	for i, leak := range leaks {
+		leakMaps[i] = map[string]interface{}{
+			"handle":    leak.handle,
+			"node":      leak.node,
+			"reason":    leak.reason,
+			"addresses": leak.addresses,
+		}
+	}
+
+	d.SetId(ipamLeaksId(cidr))
+	d.Set("leaks", leakMaps)
+
+	return nil
+}
+
+// parse an optional CIDR, nil when it's not set
+func dToOptionalCIDR(d *schema.ResourceData, field string) (*caliconet.IPNet, error) {
+	if d.Get(field).(string) == "" {
+		return nil, nil
+	}
+
+	cidr, err := dToCIDR(d, field)
+	if err != nil {
+		return nil, err
+	}
+	return &cidr, nil
+}
+
+func ipamLeaksId(cidr *caliconet.IPNet) string {
+	if cidr == nil {
+		return "ipam-leaks"
+	}
+	return "ipam-leaks/" + cidr.String()
+}
@@ -0,0 +1,72 @@
+package calico
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+func dataSourceCalicoIpPoolNextFreeCidr() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceCalicoIpPoolNextFreeCidrRead,
+
+		Schema: map[string]*schema.Schema{
+			"supernet": &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateCIDR,
+			},
+			"prefix_length": &schema.Schema{
+				Type:     schema.TypeInt,
+				Required: true,
+			},
+			"current": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"cidr": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceCalicoIpPoolNextFreeCidrRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	supernet, err := dToCIDR(d, "supernet")
+	if err != nil {
+		return err
+	}
+
+	var current *net.IPNet
+	if v := d.Get("current").(string); v != "" {
+		_, current, err = net.ParseCIDR(v)
+		if err != nil {
+			return fmt.Errorf("ERROR: current: %v", err)
+		}
+	}
+
+	// the existing pools and the reserved ranges are taken
+	list, err := config.Client.IPPools().List(api.IPPoolMetadata{})
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	pools := make([]net.IPNet, len(list.Items))
+	for i, pool := range list.Items {
+		pools[i] = pool.Metadata.CIDR.IPNet
+	}
+
+	cidr, err := allocatedCIDR(supernet.IPNet, d.Get("prefix_length").(int), current, config.reservedCIDRs, pools)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	d.SetId(cidr.String())
+	d.Set("cidr", cidr.String())
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package calico
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"regexp"
+	"sort"
+	"text/template"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/scope"
+)
+
+// routerConfig is what the router config templates are rendered from
+type routerConfig struct {
+	RouterIP  string           `json:"routerIP"`
+	ASNumber  string           `json:"asNumber"`
+	Neighbors []routerNeighbor `json:"neighbors"`
+}
+
+type routerNeighbor struct {
+	Node     string `json:"node"`
+	Name     string `json:"-"`
+	Address  string `json:"address"`
+	ASNumber string `json:"asNumber"`
+}
+
+var routerConfigTemplates = map[string]*template.Template{
+	"frr": template.Must(template.New("frr").Parse(`router bgp {{.ASNumber}}
+{{- range .Neighbors}}
+ neighbor {{.Address}} remote-as {{.ASNumber}}
+ neighbor {{.Address}} description {{.Node}}
+{{- end}}
+`)),
+	"bird": template.Must(template.New("bird").Parse(`{{range .Neighbors}}protocol bgp {{.Name}} {
+  description "{{.Node}}";
+  local {{$.RouterIP}} as {{$.ASNumber}};
+  neighbor {{.Address}} as {{.ASNumber}};
+  import all;
+  export all;
+}
+{{end}}`)),
+}
+
+var birdNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// birdNameMaxLength is the longest symbol BIRD accepts
+const birdNameMaxLength = 64
+
+// birdProtocolName returns the name of the BIRD protocol of node. Names are
+// sanitized and cut to fit BIRD symbols, a hash of the node name keeps them
+// unique, e.g. for a-b and a_b.
+func birdProtocolName(node string) string {
+	h := fnv.New32a()
+	h.Write([]byte(node))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+
+	name := "calico_" + birdNameInvalid.ReplaceAllString(node, "_")
+	if len(name) > birdNameMaxLength-len(suffix) {
+		name = name[:birdNameMaxLength-len(suffix)]
+	}
+
+	return name + suffix
+}
+
+func dataSourceCalicoRouterConfig() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceCalicoRouterConfigRead,
+
+		Schema: map[string]*schema.Schema{
+			"router_ip": &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateIP,
+			},
+			"as_number": &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateASNumber,
+			},
+			"format": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "json",
+				ValidateFunc: validateRouterConfigFormat,
+			},
+			"neighbors": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"node": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"address": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"as_number": &schema.Schema{
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+			"config": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func validateRouterConfigFormat(v interface{}, k string) (ws []string, es []error) {
+	switch v.(string) {
+	case "frr", "bird", "json":
+	default:
+		es = append(es, fmt.Errorf("%s must be %q, %q or %q, got %q", k, "frr", "bird", "json", v))
+	}
+	return
+}
+
+// routerNeighbors returns the nodes that peer with routerIP, through a global
+// peer or a peer of their own, with their address of the same family
+func routerNeighbors(config config, routerIP net.IP) ([]routerNeighbor, error) {
+	peers, err := config.Client.BGPPeers().List(api.BGPPeerMetadata{})
+	if err != nil {
+		return nil, err
+	}
+	global := false
+	peering := make(map[string]bool)
+	for _, peer := range peers.Items {
+		if !peer.Metadata.PeerIP.Equal(routerIP) {
+			continue
+		}
+		if peer.Metadata.Scope == scope.Global {
+			global = true
+		}
+		peering[peer.Metadata.Node] = true
+	}
+
+	nodes, err := config.Client.Nodes().List(api.NodeMetadata{})
+	if err != nil {
+		return nil, err
+	}
+	globalASNumber, err := config.Client.Config().GetGlobalASNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	neighbors := []routerNeighbor{}
+	for _, node := range nodes.Items {
+		if node.Spec.BGP == nil || !(global || peering[node.Metadata.Name]) {
+			continue
+		}
+
+		address := node.Spec.BGP.IPv4Address
+		if ipVersion(routerIP) == 6 {
+			address = node.Spec.BGP.IPv6Address
+		}
+		if address == nil {
+			continue
+		}
+
+		asNumber := globalASNumber
+		if node.Spec.BGP.ASNumber != nil {
+			asNumber = *node.Spec.BGP.ASNumber
+		}
+
+		neighbors = append(neighbors, routerNeighbor{
+			Node:     node.Metadata.Name,
+			Name:     birdProtocolName(node.Metadata.Name),
+			Address:  address.IP.String(),
+			ASNumber: asNumber.String(),
+		})
+	}
+	sort.Sort(routerNeighborsByNode(neighbors))
+
+	return neighbors, nil
+}
+
+type routerNeighborsByNode []routerNeighbor
+
+func (n routerNeighborsByNode) Len() int           { return len(n) }
+func (n routerNeighborsByNode) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n routerNeighborsByNode) Less(i, j int) bool { return n[i].Node < n[j].Node }
+
+func dataSourceCalicoRouterConfigRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	routerIP := net.ParseIP(d.Get("router_ip").(string))
+	neighbors, err := routerNeighbors(config, routerIP)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	router := routerConfig{
+		RouterIP:  routerIP.String(),
+		ASNumber:  d.Get("as_number").(string),
+		Neighbors: neighbors,
+	}
+
+	var rendered bytes.Buffer
+	format := d.Get("format").(string)
+	if format == "json" {
+		b, err := json.MarshalIndent(router, "", "  ")
+		if err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+		rendered.Write(b)
+	} else if err := routerConfigTemplates[format].Execute(&rendered, router); err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	neighborMaps := make([]interface{}, len(neighbors))
+	for i, neighbor := range neighbors {
+		neighborMaps[i] = map[string]interface{}{
+			"node":      neighbor.Node,
+			"address":   neighbor.Address,
+			"as_number": neighbor.ASNumber,
+		}
+	}
+
+	d.SetId(router.RouterIP + "/" + format)
+	d.Set("neighbors", neighborMaps)
+	d.Set("config", rendered.String())
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package calico
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBirdProtocolName(t *testing.T) {
+	names := make(map[string]string)
+	for _, node := range []string{"a-b", "a_b", "a.b", "a b", "calico_a_b", strings.Repeat("rack1-host1.", 10)} {
+		name := birdProtocolName(node)
+		if other, ok := names[name]; ok {
+			t.Errorf("nodes %q and %q both get protocol name %s", other, node, name)
+		}
+		names[name] = node
+
+		if len(name) > birdNameMaxLength || birdNameInvalid.MatchString(name) {
+			t.Errorf("node %q gets protocol name %s, which isn't a valid BIRD symbol", node, name)
+		}
+		if !strings.HasPrefix(name, "calico_") {
+			t.Errorf("node %q gets protocol name %s, expected it to start with calico_", node, name)
+		}
+	}
+
+	if birdProtocolName("a-b") != birdProtocolName("a-b") {
+		t.Errorf("expected the protocol name of a node to be stable")
+	}
+}
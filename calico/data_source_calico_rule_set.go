@@ -0,0 +1,145 @@
+package calico
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+func dataSourceCalicoRuleSet() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceCalicoRuleSetRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"rule": &schema.Schema{
+				Type:     schema.TypeList,
+				Required: true,
+				Elem:     ruleElemSchema(),
+			},
+			"json": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceCalicoRuleSetRead(d *schema.ResourceData, meta interface{}) error {
+	rules := make([]api.Rule, d.Get("rule.#").(int))
+	for i := range rules {
+		rule, err := resourceMapToRule(d.Get("rule." + strconv.Itoa(i)).(map[string]interface{}))
+		if err != nil {
+			return err
+		}
+		rules[i] = rule
+	}
+
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	d.SetId(d.Get("name").(string))
+	d.Set("json", string(b))
+
+	return nil
+}
+
+func validateRuleSet(v interface{}, k string) (ws []string, es []error) {
+	if _, err := parseRuleSet(v.(string)); err != nil {
+		es = append(es, fmt.Errorf("%s must be the json of a calico_rule_set: %v", k, err))
+	}
+	return
+}
+
+func parseRuleSet(s string) ([]api.Rule, error) {
+	var rules []api.Rule
+	if err := json.Unmarshal([]byte(s), &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ruleSetsRules returns the rules of the rule sets of the rule block at
+// field, in order
+func ruleSetsRules(d *schema.ResourceData, field string) ([]api.Rule, error) {
+	rules := []api.Rule{}
+
+	for _, set := range d.Get(field + ".rule_sets").([]interface{}) {
+		setRules, err := parseRuleSet(set.(string))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, setRules...)
+	}
+
+	return rules, nil
+}
+
+// dToRules returns the rules of the rule block at field: those of its rule
+// sets in order, followed by its own
+func dToRules(d *schema.ResourceData, field string) ([]api.Rule, error) {
+	rules, err := ruleSetsRules(d, field)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < d.Get(field+".rule.#").(int); i++ {
+		rule, err := resourceMapToRule(d.Get(field + ".rule." + strconv.Itoa(i)).(map[string]interface{}))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	return rules, nil
+}
+
+// rulesToBlock returns the state of the rule block at field for the rules in
+// the datastore. The rules of its rule sets are left out as long as they
+// lead the list unchanged, otherwise all rules show up as the block's own so
+// the difference is planned. All rules are exported as effective_rule.
+func rulesToBlock(d *schema.ResourceData, field string, rules []api.Rule) interface{} {
+	sets := d.Get(field + ".rule_sets").([]interface{})
+	if len(rules) == 0 && len(sets) == 0 {
+		return nil
+	}
+
+	own := rules
+	setRules, err := ruleSetsRules(d, field)
+	if err == nil && len(setRules) <= len(rules) && sameRules(setRules, rules[:len(setRules)]) {
+		own = rules[len(setRules):]
+	}
+
+	return map[string]interface{}{
+		"rule":           rulesToMap(own),
+		"rule_sets":      sets,
+		"effective_rule": rulesToMap(rules),
+	}
+}
+
+// sameRules tells whether two lists have the same rules, a nil list is the
+// same as an empty one
+func sameRules(a, b []api.Rule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, _ := json.Marshal(a[i])
+		y, _ := json.Marshal(b[i])
+		if string(x) != string(y) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package calico
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+func testRuleSet(rules ...api.Rule) string {
+	if rules == nil {
+		rules = []api.Rule{}
+	}
+	b, _ := json.Marshal(rules)
+	return string(b)
+}
+
+func testRuleBlock(t *testing.T, sets []string, own int) *schema.ResourceData {
+	ruleSets := []interface{}{}
+	for _, set := range sets {
+		ruleSets = append(ruleSets, set)
+	}
+	rules := []interface{}{}
+	for i := 0; i < own; i++ {
+		rules = append(rules, map[string]interface{}{"action": "deny", "protocol": "tcp"})
+	}
+
+	return schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"ingress": &schema.Schema{
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem:     ruleSchema(),
+		},
+	}, map[string]interface{}{
+		"ingress": []interface{}{map[string]interface{}{
+			"rule_sets": ruleSets,
+			"rule":      rules,
+		}},
+	})
+}
+
+func TestRulesToBlock(t *testing.T) {
+	dns := api.Rule{Action: "allow", Destination: api.EntityRule{Selector: "role == 'dns'"}}
+	ntp := api.Rule{Action: "allow", Destination: api.EntityRule{Selector: "role == 'ntp'"}}
+	own := api.Rule{Action: "deny", Source: api.EntityRule{Selector: "role == 'bad'"}}
+
+	cases := []struct {
+		name     string
+		sets     []string
+		rules    []api.Rule
+		expected []api.Rule
+	}{
+		{"sets and own rules", []string{testRuleSet(dns), testRuleSet(ntp)}, []api.Rule{dns, ntp, own}, []api.Rule{own}},
+		{"sets only", []string{testRuleSet(dns, ntp)}, []api.Rule{dns, ntp}, []api.Rule{}},
+		{"empty set", []string{testRuleSet(), testRuleSet(dns)}, []api.Rule{dns, own}, []api.Rule{own}},
+		{"only an empty set", []string{testRuleSet()}, []api.Rule{own}, []api.Rule{own}},
+		// set rules changed out of band show up as the block's own
+		{"changed set rule", []string{testRuleSet(dns)}, []api.Rule{ntp, own}, []api.Rule{ntp, own}},
+		{"set rule after own", []string{testRuleSet(dns)}, []api.Rule{own, dns}, []api.Rule{own, dns}},
+		{"missing set rules", []string{testRuleSet(dns, ntp)}, []api.Rule{dns}, []api.Rule{dns}},
+	}
+
+	for _, c := range cases {
+		d := testRuleBlock(t, c.sets, 1)
+		block := rulesToBlock(d, "ingress.0", c.rules).(map[string]interface{})
+
+		if !reflect.DeepEqual(block["rule"], rulesToMap(c.expected)) {
+			t.Errorf("%s: expected own rules %v, got %v", c.name, rulesToMap(c.expected), block["rule"])
+		}
+		if len(block["rule_sets"].([]interface{})) != len(c.sets) {
+			t.Errorf("%s: expected the rule sets to be kept, got %v", c.name, block["rule_sets"])
+		}
+		// the rules in effect include those of the sets
+		if !reflect.DeepEqual(block["effective_rule"], rulesToMap(c.rules)) {
+			t.Errorf("%s: expected effective rules %v, got %v", c.name, rulesToMap(c.rules), block["effective_rule"])
+		}
+	}
+
+	// a block without sets or rules stays unset
+	if block := rulesToBlock(testRuleBlock(t, nil, 0), "ingress.0", nil); block != nil {
+		t.Errorf("expected no block without rules, got %v", block)
+	}
+}
+
+func TestRulesToBlock_effectiveRuleState(t *testing.T) {
+	dns := api.Rule{Action: "allow", Destination: api.EntityRule{Selector: "role == 'dns'"}}
+	own := api.Rule{Action: "deny", Source: api.EntityRule{Selector: "role == 'bad'"}}
+
+	d := testRuleBlock(t, []string{testRuleSet(dns)}, 1)
+	if err := d.Set("ingress", []interface{}{rulesToBlock(d, "ingress.0", []api.Rule{dns, own})}); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	// the expanded rules end up in state, the set rule first
+	if n := d.Get("ingress.0.effective_rule.#").(int); n != 2 {
+		t.Fatalf("expected 2 effective rules, got %d", n)
+	}
+	if selector := d.Get("ingress.0.effective_rule.0.destination.0.selector").(string); selector != "role == 'dns'" {
+		t.Errorf("expected the set rule first, got selector %q", selector)
+	}
+	if action := d.Get("ingress.0.effective_rule.1.action").(string); action != "deny" {
+		t.Errorf("expected the own rule last, got action %q", action)
+	}
+}
+
+func TestDToRules(t *testing.T) {
+	dns := api.Rule{Action: "allow", Destination: api.EntityRule{Selector: "role == 'dns'"}}
+
+	rules, err := dToRules(testRuleBlock(t, []string{testRuleSet(), testRuleSet(dns)}, 1), "ingress.0")
+	if err != nil {
+		t.Fatalf("dToRules: %v", err)
+	}
+	if len(rules) != 2 || !sameRules(rules[:1], []api.Rule{dns}) || rules[1].Action != "deny" {
+		t.Fatalf("expected the set rule followed by the own rule, got %v", rules)
+	}
+}
+
+func TestSameRules(t *testing.T) {
+	dns := api.Rule{Action: "allow", Destination: api.EntityRule{Selector: "role == 'dns'"}}
+	ntp := api.Rule{Action: "allow", Destination: api.EntityRule{Selector: "role == 'ntp'"}}
+
+	cases := []struct {
+		a, b     []api.Rule
+		expected bool
+	}{
+		{nil, nil, true},
+		{nil, []api.Rule{}, true},
+		{[]api.Rule{dns}, []api.Rule{dns}, true},
+		{[]api.Rule{dns}, []api.Rule{ntp}, false},
+		{[]api.Rule{dns, ntp}, []api.Rule{ntp, dns}, false},
+		{[]api.Rule{dns}, []api.Rule{dns, ntp}, false},
+	}
+
+	for i, c := range cases {
+		if same := sameRules(c.a, c.b); same != c.expected {
+			t.Errorf("case %d: sameRules(%v, %v) = %v, expected %v", i, c.a, c.b, same, c.expected)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package calico
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// driftSchema is the schema of the drift attribute of resources that
+// reconcile more than a single object. Read describes in it what's out of
+// sync while config keeps it empty, so the plan shows the drift and Update
+// reconciles it.
+func driftSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		Default:      "",
+		ValidateFunc: validateNoDrift,
+	}
+}
+
+func validateNoDrift(v interface{}, k string) (ws []string, es []error) {
+	if v.(string) != "" {
+		es = append(es, fmt.Errorf("%s is set by the provider and has to stay empty in config", k))
+	}
+	return
+}
+
+// joinDrift describes several kinds of drift in one attribute
+func joinDrift(drift []string) string {
+	return strings.Join(drift, "; ")
+}
+
+// reconcileKeys converges the objects a resource manages, identified by
+// their keys, on the desired ones. It writes every desired object before
+// removing the managed ones that are no longer desired, so replacing an
+// object never leaves a gap. It returns the keys managed afterwards, also
+// when it fails halfway.
+func reconcileKeys(managed, desired []string, write func(key string) error, remove func(key string) error) ([]string, error) {
+	current := make(map[string]bool, len(managed)+len(desired))
+	for _, key := range managed {
+		current[key] = true
+	}
+	isDesired := make(map[string]bool, len(desired))
+	for _, key := range desired {
+		isDesired[key] = true
+	}
+
+	err := func() error {
+		for _, key := range desired {
+			if err := write(key); err != nil {
+				return err
+			}
+			current[key] = true
+		}
+
+		for _, key := range managed {
+			if isDesired[key] {
+				continue
+			}
+			if err := remove(key); err != nil {
+				return err
+			}
+			delete(current, key)
+		}
+		return nil
+	}()
+
+	result := make([]string, 0, len(current))
+	for key := range current {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+
+	return result, err
+}
@@ -2,7 +2,10 @@ package calico
 
 import (
 	"fmt"
+	"net"
+	"regexp"
 
+	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/projectcalico/libcalico-go/lib/api"
 	caliconet "github.com/projectcalico/libcalico-go/lib/net"
@@ -261,11 +264,157 @@ func rulesToMap(calicoRules []api.Rule) []map[string]interface{} {
 func dToCIDR(d *schema.ResourceData, field string) (caliconet.IPNet, error) {
 	_, cidr, err := caliconet.ParseCIDR(d.Get(field).(string))
 	if err != nil {
-		return *cidr, fmt.Errorf("ERROR: couldn't parse CIDR: %v", err)
+		return caliconet.IPNet{}, fmt.Errorf("ERROR: couldn't parse CIDR: %v", err)
 	}
 	return *cidr, nil
 }
 
+// the IP version of ip, 4 or 6
+func ipVersion(ip net.IP) int {
+	if ip.To4() != nil {
+		return 4
+	}
+	return 6
+}
+
+// parse an interface address in CIDR notation, keeping the host part of it.
+// A bare address, as configured before nodes took CIDRs, gets a host mask.
+func parseAddressCIDR(value string, version int) (*caliconet.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(value)
+	if err != nil {
+		ip = net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("%q isn't an address or an address with subnet mask", value)
+		}
+		ipNet = &net.IPNet{Mask: net.CIDRMask(128, 128)}
+		if ipVersion(ip) == 4 {
+			ipNet.Mask = net.CIDRMask(32, 32)
+		}
+	}
+	if ipVersion(ip) != version {
+		return nil, fmt.Errorf("%q isn't an IPv%d address", value, version)
+	}
+	if version == 4 {
+		ip = ip.To4()
+	}
+
+	return &caliconet.IPNet{IPNet: net.IPNet{IP: ip, Mask: ipNet.Mask}}, nil
+}
+
+// normalizeAddressCIDR stores an interface address the way it's read back
+func normalizeAddressCIDR(v interface{}) string {
+	ip := net.ParseIP(v.(string))
+	if ip == nil {
+		return v.(string)
+	}
+	if ipVersion(ip) == 4 {
+		return ip.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
+
+func validateAddressCIDR(version int) schema.SchemaValidateFunc {
+	return func(v interface{}, k string) (ws []string, es []error) {
+		if v.(string) == "" {
+			return
+		}
+		if _, err := parseAddressCIDR(v.(string), version); err != nil {
+			es = append(es, fmt.Errorf("%s: %v", k, err))
+		}
+		return
+	}
+}
+
+// validate a regular expression
+func validateRegexp(v interface{}, k string) (ws []string, es []error) {
+	if _, err := regexp.Compile(v.(string)); err != nil {
+		es = append(es, fmt.Errorf("%s: %v", k, err))
+	}
+	return
+}
+
+// validate an IPv4 or IPv6 address
+func validateIP(v interface{}, k string) (ws []string, es []error) {
+	if net.ParseIP(v.(string)) == nil {
+		es = append(es, fmt.Errorf("%s: %q isn't an IP address", k, v))
+	}
+	return
+}
+
+// normalizeIP stores IP addresses the way the datastore returns them
+func normalizeIP(v interface{}) string {
+	ip := net.ParseIP(v.(string))
+	if ip == nil {
+		return v.(string)
+	}
+	return ip.String()
+}
+
+// hashIP hashes sets of IP addresses on their normalized form
+func hashIP(v interface{}) int {
+	return hashcode.String(normalizeIP(v))
+}
+
+// ipsByString sorts addresses the way they're listed in config
+type ipsByString []caliconet.IP
+
+func (ips ipsByString) Len() int           { return len(ips) }
+func (ips ipsByString) Swap(i, j int)      { ips[i], ips[j] = ips[j], ips[i] }
+func (ips ipsByString) Less(i, j int) bool { return ips[i].String() < ips[j].String() }
+
+// validate the protocol of a named port, ports only exist for tcp and udp
+func validatePortProtocol(v interface{}, k string) (ws []string, es []error) {
+	switch v.(string) {
+	case "tcp", "udp":
+	default:
+		es = append(es, fmt.Errorf("%s must be %q or %q, got %q", k, "tcp", "udp", v))
+	}
+	return
+}
+
+// portNameRegexp matches the names of named ports, lowercase alphanumerics
+// and dashes that start and end with an alphanumeric
+var portNameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// validate the name of a named port
+func validatePortName(v interface{}, k string) (ws []string, es []error) {
+	if name := v.(string); len(name) > 63 || !portNameRegexp.MatchString(name) {
+		es = append(es, fmt.Errorf("%s must be at most 63 lowercase alphanumerics and dashes, starting and ending with an alphanumeric, got %q", k, name))
+	}
+	return
+}
+
+// validate a port number
+func validatePortNumber(v interface{}, k string) (ws []string, es []error) {
+	if port := v.(int); port < 1 || port > 65535 {
+		es = append(es, fmt.Errorf("%s must be between 1 and 65535, got %d", k, port))
+	}
+	return
+}
+
+// validate a network in CIDR notation, without host bits set
+func validateCIDR(v interface{}, k string) (ws []string, es []error) {
+	ip, cidr, err := net.ParseCIDR(v.(string))
+	if err != nil {
+		es = append(es, fmt.Errorf("%s: %v", k, err))
+		return
+	}
+	if !ip.Equal(cidr.IP) {
+		es = append(es, fmt.Errorf("%s: %s has host bits set, did you mean %s?", k, v, cidr.String()))
+	}
+	return
+}
+
+func validateASNumber(v interface{}, k string) (ws []string, es []error) {
+	if v.(string) == "" {
+		return
+	}
+	if _, err := numorstring.ASNumberFromString(v.(string)); err != nil {
+		es = append(es, fmt.Errorf("%s: %q isn't an AS number: %v", k, v, err))
+	}
+	return
+}
+
 func entityRuleSchema() *schema.Resource {
 	return &schema.Resource{
 		Schema: map[string]*schema.Schema{
@@ -310,65 +459,103 @@ func ruleSchema() *schema.Resource {
 				Type:     schema.TypeList,
 				Optional: true,
 				ForceNew: false,
+				Elem:     ruleElemSchema(),
+			},
+			"rule_sets": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateRuleSet,
+				},
+			},
+			"effective_rule": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     computedResource(ruleElemSchema()),
+			},
+		},
+	}
+}
+
+// computedResource returns a copy of r with every attribute computed, for
+// exporting objects the user configures elsewhere
+func computedResource(r *schema.Resource) *schema.Resource {
+	computed := make(map[string]*schema.Schema, len(r.Schema))
+	for k, v := range r.Schema {
+		elem := v.Elem
+		if resource, ok := elem.(*schema.Resource); ok {
+			elem = computedResource(resource)
+		}
+		computed[k] = &schema.Schema{
+			Type:     v.Type,
+			Computed: true,
+			Elem:     elem,
+			Set:      v.Set,
+		}
+	}
+
+	return &schema.Resource{Schema: computed}
+}
+
+// ruleElemSchema is the schema of a single rule, shared with calico_policy_rule
+func ruleElemSchema() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"action": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"protocol": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"notProtocol": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"icmp": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
-						"action": &schema.Schema{
-							Type:     schema.TypeString,
+						"type": &schema.Schema{
+							Type:     schema.TypeInt,
 							Optional: true,
 						},
-						"protocol": &schema.Schema{
-							Type:     schema.TypeString,
+						"code": &schema.Schema{
+							Type:     schema.TypeInt,
 							Required: true,
 						},
-						"notProtocol": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"icmp": &schema.Schema{
-							Type:     schema.TypeList,
-							Optional: true,
-							Elem: &schema.Resource{
-								Schema: map[string]*schema.Schema{
-									"type": &schema.Schema{
-										Type:     schema.TypeInt,
-										Optional: true,
-									},
-									"code": &schema.Schema{
-										Type:     schema.TypeInt,
-										Required: true,
-									},
-								},
-							},
-						},
-						"notICMP": &schema.Schema{
-							Type:     schema.TypeList,
-							Optional: true,
-							Elem: &schema.Resource{
-								Schema: map[string]*schema.Schema{
-									"type": &schema.Schema{
-										Type:     schema.TypeInt,
-										Optional: true,
-									},
-									"code": &schema.Schema{
-										Type:     schema.TypeInt,
-										Required: true,
-									},
-								},
-							},
-						},
-						"source": &schema.Schema{
-							Type:     schema.TypeList,
+					},
+				},
+			},
+			"notICMP": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"type": &schema.Schema{
+							Type:     schema.TypeInt,
 							Optional: true,
-							Elem:     entityRuleSchema(),
 						},
-						"destination": &schema.Schema{
-							Type:     schema.TypeList,
-							Optional: true,
-							Elem:     entityRuleSchema(),
+						"code": &schema.Schema{
+							Type:     schema.TypeInt,
+							Required: true,
 						},
 					},
 				},
 			},
+			"source": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     entityRuleSchema(),
+			},
+			"destination": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     entityRuleSchema(),
+			},
 		},
 	}
 }
@@ -0,0 +1,36 @@
+package calico
+
+import "testing"
+
+func TestParseAddressCIDR(t *testing.T) {
+	cases := []struct {
+		value    string
+		version  int
+		expected string
+	}{
+		{"10.244.0.1/24", 4, "10.244.0.1/24"},
+		{"10.244.0.1", 4, "10.244.0.1/32"},
+		{"2001:db8::1/64", 6, "2001:db8::1/64"},
+		{"2001:db8::1", 6, "2001:db8::1/128"},
+		{"10.244.0.1", 6, ""},
+		{"2001:db8::1/64", 4, ""},
+		{"not-an-address", 4, ""},
+	}
+
+	for _, c := range cases {
+		ipNet, err := parseAddressCIDR(c.value, c.version)
+		if c.expected == "" {
+			if err == nil {
+				t.Errorf("parseAddressCIDR(%q, %d) = %v, expected an error", c.value, c.version, ipNet)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAddressCIDR(%q, %d) returned error %v", c.value, c.version, err)
+			continue
+		}
+		if ipNet.String() != c.expected || normalizeAddressCIDR(c.value) != c.expected {
+			t.Errorf("parseAddressCIDR(%q, %d) = %v, normalized %s, expected %s", c.value, c.version, ipNet, normalizeAddressCIDR(c.value), c.expected)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package calico
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	"github.com/projectcalico/libcalico-go/lib/client"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+)
+
+// number of handles named in errors and progress logs
+const sampleHandles = 5
+
+// ipipTunnelHandlePrefix starts the handles calico/node assigns IPIP tunnel
+// addresses to
+const ipipTunnelHandlePrefix = "ipip-tunnel-addr-"
+
+// allocationCount counts the addresses allocated in IPAM blocks. Workload
+// addresses keep a pool in use, the others, like the IPIP tunnel addresses
+// calico/node assigns to itself, go away with the pool.
+type allocationCount struct {
+	workloads int
+	other     int
+}
+
+func (c allocationCount) total() int {
+	return c.workloads + c.other
+}
+
+// ipamAllocations counts the addresses IPAM allocated from the blocks within
+// cidr, and returns a sorted sample of the workload handles holding them
+func ipamAllocations(calicoClient *client.Client, cidr caliconet.IPNet) (allocationCount, []string, error) {
+	count := allocationCount{}
+
+	kvps, err := calicoClient.Backend.List(model.BlockListOptions{IPVersion: ipVersion(cidr.IP)})
+	if err != nil {
+		return count, nil, err
+	}
+
+	handles := make(map[string]bool)
+	for _, kvp := range kvps {
+		block := kvp.Value.(*model.AllocationBlock)
+		if !cidrsOverlap(cidr.IPNet, block.CIDR.IPNet) {
+			continue
+		}
+
+		blockCount := blockAllocations(block, handles)
+		count.workloads += blockCount.workloads
+		count.other += blockCount.other
+	}
+	if count.other > 0 {
+		log.Printf("[DEBUG] IP pool %s has %d allocations that don't belong to workloads, like IPIP tunnel addresses", cidr.String(), count.other)
+	}
+
+	sample := make([]string, 0, len(handles))
+	for handle := range handles {
+		sample = append(sample, handle)
+	}
+	sort.Strings(sample)
+	if len(sample) > sampleHandles {
+		sample = sample[:sampleHandles]
+	}
+
+	return count, sample, nil
+}
+
+// blockAllocations counts the addresses allocated in block and adds the
+// workload handles holding them to handles
+func blockAllocations(block *model.AllocationBlock, handles map[string]bool) allocationCount {
+	count := allocationCount{}
+
+	for _, attr := range block.Allocations {
+		if attr == nil {
+			continue
+		}
+		if *attr >= len(block.Attributes) || !workloadAllocation(block.Attributes[*attr]) {
+			count.other++
+			continue
+		}
+		count.workloads++
+		handles[*block.Attributes[*attr].AttrPrimary] = true
+	}
+
+	return count
+}
+
+// workloadAllocation tells whether an allocation belongs to a workload, it
+// has a handle that isn't an IPIP tunnel's
+func workloadAllocation(attr model.AllocationAttribute) bool {
+	if attr.AttrPrimary == nil || strings.HasPrefix(*attr.AttrPrimary, ipipTunnelHandlePrefix) {
+		return false
+	}
+	return attr.AttrSecondary["type"] != "ipipTunnelAddress"
+}
+
+// drainIPPool disables pool so IPAM stops assigning addresses from it, and
+// waits up to timeout for the existing allocations to be released
+func drainIPPool(config config, calicoClient *client.Client, pool *api.IPPool, timeout time.Duration) error {
+	cidr := pool.Metadata.CIDR
+
+	if !pool.Spec.Disabled {
+		disabled := *pool
+		disabled.Spec.Disabled = true
+
+		log.Printf("[INFO] disabling IP pool %s to drain it", cidr.String())
+		config.cache.invalidate(ipPoolCacheKey(pool.Metadata))
+		if _, err := calicoClient.IPPools().Apply(&disabled); err != nil {
+			return err
+		}
+	}
+
+	return resource.Retry(timeout, func() *resource.RetryError {
+		count, handles, err := ipamAllocations(calicoClient, cidr)
+		if err != nil {
+			return resource.NonRetryableError(err)
+		}
+		if count.workloads > 0 {
+			log.Printf("[INFO] waiting for %d allocations in IP pool %s to be released, e.g. handles %v", count.workloads, cidr.String(), handles)
+			return resource.RetryableError(fmt.Errorf("IP pool %s still has %d allocations after draining for %s, e.g. handles %v; the pool was left disabled",
+				cidr.String(), count.workloads, timeout, handles))
+		}
+		return nil
+	})
+}
+
+// ipamLeak is a handle holding IPAM allocations that no workload endpoint
+// accounts for
+type ipamLeak struct {
+	handle    string
+	node      string
+	reason    string
+	addresses []string
+}
+
+// findIPAMLeaks cross-references the IPAM allocations within cidr, or all of
+// them when cidr is nil, with the workload endpoints and nodes. A handle is
+// in use when a workload endpoint carries its workload ID or one of its
+// addresses.
+func findIPAMLeaks(calicoClient *client.Client, cidr *caliconet.IPNet) ([]ipamLeak, error) {
+	workloadEndpoints, err := calicoClient.WorkloadEndpoints().List(api.WorkloadEndpointMetadata{})
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := calicoClient.Nodes().List(api.NodeMetadata{})
+	if err != nil {
+		return nil, err
+	}
+	kvps, err := calicoClient.Backend.List(model.BlockListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := make(map[string]bool)
+	for _, wep := range workloadEndpoints.Items {
+		inUse[wep.Metadata.Workload] = true
+		for _, ipNet := range wep.Spec.IPNetworks {
+			inUse[ipNet.IP.String()] = true
+		}
+	}
+	nodeExists := make(map[string]bool)
+	for _, node := range nodes.Items {
+		nodeExists[node.Metadata.Name] = true
+	}
+
+	leaks := make(map[string]*ipamLeak)
+	for _, kvp := range kvps {
+		block := kvp.Value.(*model.AllocationBlock)
+		if cidr != nil && !cidrsOverlap(cidr.IPNet, block.CIDR.IPNet) {
+			continue
+		}
+		blockLeaks(block, nodeExists, leaks)
+	}
+
+	return unusedLeaks(leaks, inUse), nil
+}
+
+// blockLeaks adds the workload allocations in block to leaks, by handle.
+// Allocations without a handle and the IPIP tunnel addresses calico/node
+// assigns itself belong to no workload endpoint and are never leaks.
+func blockLeaks(block *model.AllocationBlock, nodeExists map[string]bool, leaks map[string]*ipamLeak) {
+	node := ""
+	if block.HostAffinity != nil {
+		node = *block.HostAffinity
+	}
+	_, bits := block.CIDR.Mask.Size()
+	base := ipToInt(block.CIDR.IP)
+
+	for ordinal, attr := range block.Allocations {
+		if attr == nil || *attr >= len(block.Attributes) || !workloadAllocation(block.Attributes[*attr]) {
+			continue
+		}
+		handle := *block.Attributes[*attr].AttrPrimary
+		address := intToIP(new(big.Int).Add(base, big.NewInt(int64(ordinal))), bits).String()
+
+		leak, ok := leaks[handle]
+		if !ok {
+			reason := "no workload endpoint"
+			if node != "" && !nodeExists[node] {
+				reason = "node " + node + " no longer exists"
+			}
+			leak = &ipamLeak{handle: handle, node: node, reason: reason}
+			leaks[handle] = leak
+		}
+		leak.addresses = append(leak.addresses, address)
+	}
+}
+
+// unusedLeaks returns the leaks whose handle and addresses are not in use,
+// sorted by handle
+func unusedLeaks(leaks map[string]*ipamLeak, inUse map[string]bool) []ipamLeak {
+	result := []ipamLeak{}
+	for handle, leak := range leaks {
+		used := inUse[handle]
+		for _, address := range leak.addresses {
+			used = used || inUse[address]
+		}
+		if !used {
+			result = append(result, *leak)
+		}
+	}
+	sort.Sort(ipamLeaksByHandle(result))
+
+	return result
+}
+
+type ipamLeaksByHandle []ipamLeak
+
+func (l ipamLeaksByHandle) Len() int           { return len(l) }
+func (l ipamLeaksByHandle) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l ipamLeaksByHandle) Less(i, j int) bool { return l[i].handle < l[j].handle }
+
+// validate a duration like 10m or 1h30m
+func validateDuration(v interface{}, k string) (ws []string, es []error) {
+	if _, err := time.ParseDuration(v.(string)); err != nil {
+		es = append(es, fmt.Errorf("%s: %v", k, err))
+	}
+	return
+}
@@ -0,0 +1,114 @@
+package calico
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+)
+
+func testAllocationBlock(attributes []model.AllocationAttribute, allocations ...int) *model.AllocationBlock {
+	block := &model.AllocationBlock{
+		Allocations: make([]*int, 8),
+		Attributes:  attributes,
+	}
+	for i, attr := range allocations {
+		attr := attr
+		block.Allocations[i] = &attr
+	}
+	return block
+}
+
+func testHandle(handle string) *string {
+	return &handle
+}
+
+func TestBlockAllocations(t *testing.T) {
+	block := testAllocationBlock([]model.AllocationAttribute{
+		{AttrPrimary: testHandle("k8s-pod-network.a")},
+		{AttrPrimary: testHandle("k8s-pod-network.b")},
+		{AttrPrimary: testHandle("ipip-tunnel-addr-node1")},
+		{AttrPrimary: testHandle("node1"), AttrSecondary: map[string]string{"node": "node1", "type": "ipipTunnelAddress"}},
+		{},
+	}, 0, 1, 1, 2, 3, 4)
+
+	handles := make(map[string]bool)
+	count := blockAllocations(block, handles)
+
+	if count.workloads != 3 || count.other != 3 || count.total() != 6 {
+		t.Fatalf("expected 3 workload and 3 other allocations, got %+v", count)
+	}
+	expected := map[string]bool{"k8s-pod-network.a": true, "k8s-pod-network.b": true}
+	if !reflect.DeepEqual(handles, expected) {
+		t.Fatalf("expected handles %v, got %v", expected, handles)
+	}
+}
+
+func TestBlockAllocations_tunnelOnly(t *testing.T) {
+	// an IPIP pool that only has the tunnel addresses of its nodes left is
+	// drained
+	block := testAllocationBlock([]model.AllocationAttribute{
+		{AttrPrimary: testHandle("ipip-tunnel-addr-node1")},
+		{AttrPrimary: testHandle("ipip-tunnel-addr-node2")},
+	}, 0, 1)
+
+	handles := make(map[string]bool)
+	count := blockAllocations(block, handles)
+
+	if count.workloads != 0 || count.other != 2 {
+		t.Fatalf("expected only 2 other allocations, got %+v", count)
+	}
+	if len(handles) != 0 {
+		t.Fatalf("expected no workload handles, got %v", handles)
+	}
+}
+
+func TestBlockLeaks(t *testing.T) {
+	node := "node1"
+	_, cidr, _ := caliconet.ParseCIDR("10.1.0.0/26")
+	block := testAllocationBlock([]model.AllocationAttribute{
+		{AttrPrimary: testHandle("ipip-tunnel-addr-node1")},
+		{AttrPrimary: testHandle("node1"), AttrSecondary: map[string]string{"node": "node1", "type": "ipipTunnelAddress"}},
+		{},
+		{AttrPrimary: testHandle("k8s-pod-network.live")},
+		{AttrPrimary: testHandle("k8s-pod-network.leaked")},
+	}, 0, 1, 2, 3, 4)
+	block.CIDR = *cidr
+	block.HostAffinity = &node
+
+	leaks := make(map[string]*ipamLeak)
+	blockLeaks(block, map[string]bool{"node1": true}, leaks)
+
+	// tunnel addresses and allocations without a handle are never leaks
+	if len(leaks) != 2 || leaks["k8s-pod-network.live"] == nil || leaks["k8s-pod-network.leaked"] == nil {
+		t.Fatalf("expected only the workload handles as candidates, got %v", leaks)
+	}
+	if addresses := leaks["k8s-pod-network.leaked"].addresses; !reflect.DeepEqual(addresses, []string{"10.1.0.4"}) {
+		t.Fatalf("expected the leaked handle to hold 10.1.0.4, got %v", addresses)
+	}
+
+	result := unusedLeaks(leaks, map[string]bool{"10.1.0.3": true})
+	if len(result) != 1 || result[0].handle != "k8s-pod-network.leaked" || result[0].reason != "no workload endpoint" {
+		t.Fatalf("expected only k8s-pod-network.leaked to leak, got %+v", result)
+	}
+}
+
+func TestBlockLeaks_nodeGone(t *testing.T) {
+	node := "node2"
+	_, cidr, _ := caliconet.ParseCIDR("10.1.0.64/26")
+	block := testAllocationBlock([]model.AllocationAttribute{
+		{AttrPrimary: testHandle("ipip-tunnel-addr-node2")},
+		{AttrPrimary: testHandle("k8s-pod-network.a")},
+	}, 0, 1)
+	block.CIDR = *cidr
+	block.HostAffinity = &node
+
+	leaks := make(map[string]*ipamLeak)
+	blockLeaks(block, map[string]bool{}, leaks)
+
+	result := unusedLeaks(leaks, map[string]bool{})
+	if len(result) != 1 || result[0].handle != "k8s-pod-network.a" || result[0].reason != "node node2 no longer exists" {
+		t.Fatalf("expected the tunnel address of a removed node to be left alone, got %+v", result)
+	}
+}
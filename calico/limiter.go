@@ -0,0 +1,105 @@
+package calico
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+)
+
+// requestLimiter bounds the number of datastore requests in flight and the
+// rate at which new requests are started. A zero setting disables that limit.
+type requestLimiter struct {
+	slots chan struct{}
+
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRequestLimiter(maxConcurrent int, perSecond float64) *requestLimiter {
+	limiter := &requestLimiter{}
+
+	if maxConcurrent > 0 {
+		limiter.slots = make(chan struct{}, maxConcurrent)
+	}
+	if perSecond > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+
+	return limiter
+}
+
+// acquire blocks until a request may be sent and returns the func that
+// releases it again
+func (l *requestLimiter) acquire(op string, subject interface{}) func() {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			log.Printf("[DEBUG] throttling %s %v: %d requests in flight", op, subject, cap(l.slots))
+			l.slots <- struct{}{}
+		}
+	}
+
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		start := l.next
+		if start.Before(now) {
+			start = now
+		}
+		l.next = start.Add(l.interval)
+		l.mu.Unlock()
+
+		if wait := start.Sub(now); wait > 0 {
+			log.Printf("[DEBUG] throttling %s %v: waiting %v for the request rate limit", op, subject, wait)
+			time.Sleep(wait)
+		}
+	}
+
+	return func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+}
+
+// throttledBackend passes every datastore call of the calico client through
+// the shared requestLimiter
+type throttledBackend struct {
+	bapi.Client
+	limiter *requestLimiter
+}
+
+func (b throttledBackend) Create(object *model.KVPair) (*model.KVPair, error) {
+	defer b.limiter.acquire("create", object.Key)()
+	return b.Client.Create(object)
+}
+
+func (b throttledBackend) Update(object *model.KVPair) (*model.KVPair, error) {
+	defer b.limiter.acquire("update", object.Key)()
+	return b.Client.Update(object)
+}
+
+func (b throttledBackend) Apply(object *model.KVPair) (*model.KVPair, error) {
+	defer b.limiter.acquire("apply", object.Key)()
+	return b.Client.Apply(object)
+}
+
+func (b throttledBackend) Delete(object *model.KVPair) error {
+	defer b.limiter.acquire("delete", object.Key)()
+	return b.Client.Delete(object)
+}
+
+func (b throttledBackend) Get(key model.Key) (*model.KVPair, error) {
+	defer b.limiter.acquire("get", key)()
+	return b.Client.Get(key)
+}
+
+func (b throttledBackend) List(list model.ListInterface) ([]*model.KVPair, error) {
+	defer b.limiter.acquire("list", list)()
+	return b.Client.List(list)
+}
@@ -0,0 +1,56 @@
+package calico
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiter_concurrency(t *testing.T) {
+	limiter := newRequestLimiter(2, 0)
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := limiter.acquire("get", "test")
+			defer release()
+
+			mu.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight > 2 {
+		t.Fatalf("expected at most 2 requests in flight, got %d", maxInFlight)
+	}
+}
+
+func TestRequestLimiter_rate(t *testing.T) {
+	limiter := newRequestLimiter(0, 100)
+
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		limiter.acquire("get", "test")()
+	}
+
+	// the first request starts immediately, the other 10 are spaced 10ms apart
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected 11 requests at 100/s to take at least 100ms, took %v", elapsed)
+	}
+}
@@ -0,0 +1,94 @@
+package calico
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Update modes. In replace mode an update writes the complete object as
+// configured, in merge mode it only overwrites the attributes that are set
+// in config and leaves everything else to other actors.
+const (
+	updateModeReplace = "replace"
+	updateModeMerge   = "merge"
+)
+
+func validateUpdateMode(allowEmpty bool) schema.SchemaValidateFunc {
+	return func(v interface{}, k string) (ws []string, es []error) {
+		switch v.(string) {
+		case updateModeReplace, updateModeMerge:
+		case "":
+			if !allowEmpty {
+				es = append(es, fmt.Errorf("%s must be %q or %q", k, updateModeReplace, updateModeMerge))
+			}
+		default:
+			es = append(es, fmt.Errorf("%s must be %q or %q, got %q", k, updateModeReplace, updateModeMerge, v))
+		}
+		return
+	}
+}
+
+// mergeOnUpdate tells whether the resource in d is updated in merge mode,
+// either by itself or through the provider wide update_mode
+func (c config) mergeOnUpdate(d *schema.ResourceData) bool {
+	mode := d.Get("update_mode").(string)
+	if mode == "" {
+		mode = c.updateMode
+	}
+
+	return mode == updateModeMerge
+}
+
+// mergeLabels keeps the labels set by others, removes the ones Terraform
+// stopped managing and sets the configured ones
+func mergeLabels(existing map[string]string, d *schema.ResourceData, field string) map[string]string {
+	labels := make(map[string]string, len(existing))
+	for k, v := range existing {
+		labels[k] = v
+	}
+
+	o, n := d.GetChange(field)
+	for k := range o.(map[string]interface{}) {
+		delete(labels, k)
+	}
+	for k, v := range n.(map[string]interface{}) {
+		labels[k] = v.(string)
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// managedLabels returns the labels Terraform manages, in merge mode those are
+// only the keys it already has in state
+func managedLabels(d *schema.ResourceData, merge bool, field string, labels map[string]string) map[string]string {
+	if !merge {
+		return labels
+	}
+
+	managed := make(map[string]string)
+	for k := range d.Get(field).(map[string]interface{}) {
+		if v, ok := labels[k]; ok {
+			managed[k] = v
+		}
+	}
+
+	return managed
+}
+
+// managedValue returns the value read from the datastore for field, unless
+// Terraform leaves the field to others because it's unset in merge mode
+func managedValue(d *schema.ResourceData, merge bool, field string, value interface{}) interface{} {
+	if v, ok := d.GetOk(field); merge && !ok {
+		return v
+	}
+	return value
+}
+
+// setManaged sets field to the value read from the datastore, see managedValue
+func setManaged(d *schema.ResourceData, merge bool, field string, value interface{}) {
+	d.Set(field, managedValue(d, merge, field, value))
+}
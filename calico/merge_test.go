@@ -0,0 +1,119 @@
+package calico
+
+import (
+	"reflect"
+	"testing"
+
+	tfconfig "github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+var testMergeSchema = map[string]*schema.Schema{
+	"labels": &schema.Schema{
+		Type:     schema.TypeMap,
+		Optional: true,
+	},
+	"selector": &schema.Schema{
+		Type:     schema.TypeString,
+		Optional: true,
+	},
+	"disabled": &schema.Schema{
+		Type:     schema.TypeBool,
+		Optional: true,
+	},
+}
+
+// testUpdate runs update on the resource data of an update from state to raw
+// config, the way Terraform does on apply
+func testUpdate(t *testing.T, state map[string]string, raw map[string]interface{}, update func(d *schema.ResourceData)) {
+	rawConfig, err := tfconfig.NewRawConfig(raw)
+	if err != nil {
+		t.Fatalf("raw config: %v", err)
+	}
+
+	r := &schema.Resource{
+		Schema: testMergeSchema,
+		Update: func(d *schema.ResourceData, meta interface{}) error {
+			update(d)
+			return nil
+		},
+	}
+	s := &terraform.InstanceState{ID: "test", Attributes: state}
+	diff, err := r.Diff(s, terraform.NewResourceConfig(rawConfig))
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if diff == nil {
+		update(r.Data(s))
+		return
+	}
+	if _, err := r.Apply(s, diff, nil); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+}
+
+func TestMergeLabels(t *testing.T) {
+	existing := map[string]string{"owner": "someone-else", "role": "old", "dropped": "x"}
+	state := map[string]string{"labels.%": "2", "labels.role": "old", "labels.dropped": "x"}
+
+	var merged map[string]string
+	testUpdate(t, state, map[string]interface{}{
+		"labels": map[string]interface{}{"role": "worker", "zone": "a"},
+	}, func(d *schema.ResourceData) {
+		merged = mergeLabels(existing, d, "labels")
+	})
+
+	// labels of others are kept, dropped keys are removed and configured ones set
+	expected := map[string]string{"owner": "someone-else", "role": "worker", "zone": "a"}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Fatalf("expected %v, got %v", expected, merged)
+	}
+	if existing["role"] != "old" {
+		t.Fatalf("mergeLabels changed the existing labels")
+	}
+}
+
+func TestManagedLabels(t *testing.T) {
+	labels := map[string]string{"owner": "someone-else", "role": "worker"}
+	d := schema.TestResourceDataRaw(t, testMergeSchema, map[string]interface{}{
+		"labels": map[string]interface{}{"role": "old"},
+	})
+
+	if managed := managedLabels(d, false, "labels", labels); !reflect.DeepEqual(managed, labels) {
+		t.Fatalf("expected all labels in replace mode, got %v", managed)
+	}
+	if managed := managedLabels(d, true, "labels", labels); !reflect.DeepEqual(managed, map[string]string{"role": "worker"}) {
+		t.Fatalf("expected only the configured keys in merge mode, got %v", managed)
+	}
+}
+
+func TestManagedValue(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, testMergeSchema, map[string]interface{}{
+		"selector": "role == 'worker'",
+		"disabled": false,
+	})
+
+	cases := []struct {
+		merge    bool
+		field    string
+		value    interface{}
+		expected interface{}
+	}{
+		{false, "selector", "changed", "changed"},
+		{true, "selector", "changed", "changed"},
+		{false, "labels", map[string]string{"a": "b"}, map[string]string{"a": "b"}},
+		// unset fields are left to others in merge mode
+		{true, "labels", map[string]string{"a": "b"}, map[string]interface{}{}},
+		// zero values can't be told from unset ones, so they aren't managed
+		// in merge mode either
+		{true, "disabled", true, false},
+		{false, "disabled", true, true},
+	}
+
+	for _, c := range cases {
+		if value := managedValue(d, c.merge, c.field, c.value); !reflect.DeepEqual(value, c.expected) {
+			t.Errorf("managedValue(merge %v, %s, %v) = %#v, expected %#v", c.merge, c.field, c.value, value, c.expected)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package calico
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/projectcalico/libcalico-go/lib/api"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+)
+
+// cidrsOverlap tells whether two networks share addresses, networks are
+// either disjoint or one contains the other
+func cidrsOverlap(a, b net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// nextFreeCIDR returns the lowest network with prefixLength in supernet that
+// overlaps none of the used networks
+func nextFreeCIDR(supernet net.IPNet, prefixLength int, used []net.IPNet) (*net.IPNet, error) {
+	ones, bits := supernet.Mask.Size()
+	if prefixLength < ones || prefixLength > bits {
+		return nil, fmt.Errorf("prefix length %d doesn't fit in %s", prefixLength, supernet.String())
+	}
+
+	size := new(big.Int).Lsh(big.NewInt(1), uint(bits-prefixLength))
+	candidate := ipToInt(supernet.IP.Mask(supernet.Mask))
+	end := new(big.Int).Add(candidate, new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)))
+
+	for candidate.Cmp(end) < 0 {
+		subnet := net.IPNet{
+			IP:   intToIP(candidate, bits),
+			Mask: net.CIDRMask(prefixLength, bits),
+		}
+		next := new(big.Int).Add(candidate, size)
+
+		free := true
+		for _, u := range used {
+			if ipVersion(u.IP) != ipVersion(subnet.IP) || !cidrsOverlap(u, subnet) {
+				continue
+			}
+			free = false
+
+			// skip the rest of a used network that's larger than a candidate
+			usedOnes, _ := u.Mask.Size()
+			usedEnd := new(big.Int).Add(ipToInt(u.IP.Mask(u.Mask)), new(big.Int).Lsh(big.NewInt(1), uint(bits-usedOnes)))
+			if usedEnd.Cmp(next) > 0 {
+				next = usedEnd.Add(usedEnd, new(big.Int).Sub(size, big.NewInt(1)))
+				next.Div(next, size).Mul(next, size)
+			}
+		}
+		if free {
+			return &subnet, nil
+		}
+
+		candidate = next
+	}
+
+	return nil, fmt.Errorf("no free /%d left in %s", prefixLength, supernet.String())
+}
+
+// allocatedCIDR returns current, a network handed out before, as long as
+// it's still a network with prefixLength in supernet that overlaps no
+// reserved range and no pool other than the one created from it. Without
+// current it returns the next free network.
+func allocatedCIDR(supernet net.IPNet, prefixLength int, current *net.IPNet, reserved, pools []net.IPNet) (*net.IPNet, error) {
+	if current == nil {
+		used := append(append([]net.IPNet{}, reserved...), pools...)
+		return nextFreeCIDR(supernet, prefixLength, used)
+	}
+
+	if ones, _ := current.Mask.Size(); ones != prefixLength || !supernet.Contains(current.IP) {
+		return nil, fmt.Errorf("current CIDR %s isn't a /%d in %s", current.String(), prefixLength, supernet.String())
+	}
+	if conflicts := ipPoolOverlaps(*current, "", reserved, pools); len(conflicts) > 0 {
+		return nil, fmt.Errorf("current CIDR %s overlaps with %s", current.String(), strings.Join(conflicts, ", "))
+	}
+
+	return current, nil
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	if v4 := ip.To4(); v4 != nil {
+		return new(big.Int).SetBytes(v4)
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func intToIP(i *big.Int, bits int) net.IP {
+	b := i.Bytes()
+	ip := make(net.IP, bits/8)
+	copy(ip[len(ip)-len(b):], b)
+	return ip
+}
+
+// parseReservedCIDRs parses the provider wide reserved_cidrs
+func parseReservedCIDRs(values []interface{}) ([]net.IPNet, error) {
+	reserved := make([]net.IPNet, 0, len(values))
+
+	for _, v := range values {
+		_, cidr, err := net.ParseCIDR(v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("reserved_cidrs: %v", err)
+		}
+		reserved = append(reserved, *cidr)
+	}
+
+	return reserved, nil
+}
+
+// ipPoolWrites serializes the overlap check of a pool with its write, so
+// pools created in parallel are checked against each other
+var ipPoolWrites sync.Mutex
+
+// ipPoolOverlaps lists the reserved ranges and pools cidr overlaps with,
+// other than itself and the pool it's replacing
+func ipPoolOverlaps(cidr net.IPNet, replacing string, reserved, pools []net.IPNet) []string {
+	conflicts := []string{}
+
+	for _, r := range reserved {
+		if cidrsOverlap(r, cidr) {
+			conflicts = append(conflicts, fmt.Sprintf("reserved range %s", r.String()))
+		}
+	}
+	for _, pool := range pools {
+		if pool.String() == cidr.String() || pool.String() == replacing {
+			continue
+		}
+		if cidrsOverlap(pool, cidr) {
+			conflicts = append(conflicts, fmt.Sprintf("IP pool %s", pool.String()))
+		}
+	}
+
+	return conflicts
+}
+
+// checkIPPoolOverlap fails when cidr overlaps with a reserved range or with
+// any other IP pool in the datastore, except for the pool it's replacing.
+// The caller holds ipPoolWrites until the pool is written.
+func (c config) checkIPPoolOverlap(cidr caliconet.IPNet, replacing string) error {
+	list, err := c.Client.IPPools().List(api.IPPoolMetadata{})
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	pools := make([]net.IPNet, len(list.Items))
+	for i, pool := range list.Items {
+		pools[i] = pool.Metadata.CIDR.IPNet
+	}
+
+	if conflicts := ipPoolOverlaps(cidr.IPNet, replacing, c.reservedCIDRs, pools); len(conflicts) > 0 {
+		return fmt.Errorf("ERROR: IP pool %s overlaps with %s", cidr.String(), strings.Join(conflicts, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package calico
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestNextFreeCIDR(t *testing.T) {
+	cases := []struct {
+		supernet string
+		prefix   int
+		used     []string
+		expected string
+	}{
+		{"10.1.0.0/16", 20, nil, "10.1.0.0/20"},
+		{"10.1.0.0/16", 20, []string{"10.1.0.0/20", "10.1.32.0/20"}, "10.1.16.0/20"},
+		{"10.1.0.0/16", 20, []string{"10.1.0.0/19", "10.1.36.0/24"}, "10.1.48.0/20"},
+		{"10.1.0.0/16", 20, []string{"10.0.0.0/8"}, ""},
+		{"10.1.0.0/16", 20, []string{"fd00::/8", "10.2.0.0/16"}, "10.1.0.0/20"},
+		{"fd80:24e2::/32", 64, []string{"fd80:24e2::/48"}, "fd80:24e2:1::/64"},
+	}
+
+	for _, c := range cases {
+		_, supernet, _ := net.ParseCIDR(c.supernet)
+		used := []net.IPNet{}
+		for _, u := range c.used {
+			_, cidr, _ := net.ParseCIDR(u)
+			used = append(used, *cidr)
+		}
+
+		cidr, err := nextFreeCIDR(*supernet, c.prefix, used)
+		if c.expected == "" {
+			if err == nil {
+				t.Errorf("%s/%d with %v: expected an error, got %s", c.supernet, c.prefix, c.used, cidr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s/%d with %v: %v", c.supernet, c.prefix, c.used, err)
+			continue
+		}
+		if cidr.String() != c.expected {
+			t.Errorf("%s/%d with %v: expected %s, got %s", c.supernet, c.prefix, c.used, c.expected, cidr)
+		}
+	}
+}
+
+func testCIDRs(values []string) []net.IPNet {
+	cidrs := []net.IPNet{}
+	for _, v := range values {
+		_, cidr, _ := net.ParseCIDR(v)
+		cidrs = append(cidrs, *cidr)
+	}
+	return cidrs
+}
+
+func TestCIDRsOverlap(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected bool
+	}{
+		{"10.1.0.0/16", "10.1.0.0/16", true},
+		{"10.1.0.0/16", "10.1.32.0/20", true},
+		{"10.1.32.0/20", "10.1.0.0/16", true},
+		{"10.1.0.0/16", "10.2.0.0/16", false},
+		{"10.1.0.0/20", "10.1.16.0/20", false},
+		{"fd80:24e2::/32", "fd80:24e2:1::/48", true},
+		{"fd80:24e2::/32", "fd80:24e3::/32", false},
+	}
+
+	for _, c := range cases {
+		cidrs := testCIDRs([]string{c.a, c.b})
+		if overlap := cidrsOverlap(cidrs[0], cidrs[1]); overlap != c.expected {
+			t.Errorf("cidrsOverlap(%s, %s) = %v, expected %v", c.a, c.b, overlap, c.expected)
+		}
+	}
+}
+
+func TestIPPoolOverlaps(t *testing.T) {
+	reserved := testCIDRs([]string{"10.96.0.0/12"})
+	pools := testCIDRs([]string{"10.1.0.0/16", "10.2.0.0/16", "fd80:24e2::/48"})
+
+	cases := []struct {
+		cidr      string
+		replacing string
+		expected  []string
+	}{
+		{"10.3.0.0/16", "", []string{}},
+		// a pool doesn't overlap with itself
+		{"10.1.0.0/16", "", []string{}},
+		{"10.1.128.0/17", "", []string{"IP pool 10.1.0.0/16"}},
+		{"10.0.0.0/8", "", []string{"reserved range 10.96.0.0/12", "IP pool 10.1.0.0/16", "IP pool 10.2.0.0/16"}},
+		// nor with the pool it's replacing
+		{"10.1.128.0/17", "10.1.0.0/16", []string{}},
+		{"10.0.0.0/14", "10.1.0.0/16", []string{"IP pool 10.2.0.0/16"}},
+		{"fd80:24e2:0:1::/64", "", []string{"IP pool fd80:24e2::/48"}},
+		{"fd80:24e3::/48", "", []string{}},
+	}
+
+	for _, c := range cases {
+		cidr := testCIDRs([]string{c.cidr})[0]
+		if conflicts := ipPoolOverlaps(cidr, c.replacing, reserved, pools); !reflect.DeepEqual(conflicts, c.expected) {
+			t.Errorf("ipPoolOverlaps(%s, %q) = %q, expected %q", c.cidr, c.replacing, conflicts, c.expected)
+		}
+	}
+}
+
+func TestAllocatedCIDR(t *testing.T) {
+	supernet := testCIDRs([]string{"10.1.0.0/16"})[0]
+	reserved := testCIDRs([]string{"10.1.16.0/20"})
+
+	cases := []struct {
+		current  string
+		pools    []string
+		expected string
+	}{
+		// the first allocation takes the lowest free network
+		{"", nil, "10.1.0.0/20"},
+		{"", []string{"10.1.0.0/20"}, "10.1.32.0/20"},
+		// a network allocated before is still returned once its pool exists
+		{"10.1.0.0/20", []string{"10.1.0.0/20"}, "10.1.0.0/20"},
+		{"10.1.48.0/20", []string{"10.1.0.0/20", "10.1.48.0/20"}, "10.1.48.0/20"},
+		// and before it's created
+		{"10.1.48.0/20", []string{"10.1.0.0/20"}, "10.1.48.0/20"},
+		// a network that no longer fits fails
+		{"10.1.0.0/20", []string{"10.1.0.0/16"}, ""},
+		{"10.1.16.0/20", nil, ""},
+		{"10.1.0.0/24", nil, ""},
+		{"10.2.0.0/20", nil, ""},
+	}
+
+	for _, c := range cases {
+		var current *net.IPNet
+		if c.current != "" {
+			current = &testCIDRs([]string{c.current})[0]
+		}
+
+		cidr, err := allocatedCIDR(supernet, 20, current, reserved, testCIDRs(c.pools))
+		if c.expected == "" {
+			if err == nil {
+				t.Errorf("current %s with pools %v: expected an error, got %s", c.current, c.pools, cidr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("current %s with pools %v: %v", c.current, c.pools, err)
+			continue
+		}
+		if cidr.String() != c.expected {
+			t.Errorf("current %s with pools %v: expected %s, got %s", c.current, c.pools, c.expected, cidr)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package calico
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+// Room left between policies placed relative to each other, and the room
+// below which the policies after a new one are moved up to make space
+const (
+	policyOrderGap    = 100
+	policyOrderMinGap = 1
+)
+
+// policyOrderConstraint lists the policies a policy comes after and before
+type policyOrderConstraint struct {
+	after  []string
+	before []string
+}
+
+func (c policyOrderConstraint) relative() bool {
+	return len(c.after) > 0 || len(c.before) > 0
+}
+
+// Annotations a relatively placed policy records its order_after and
+// order_before in, so the constraints between policies are rebuilt from the
+// datastore, whichever configuration or -target placed them
+const (
+	policyOrderAfterAnnotation  = "terraform-provider-calico/order-after"
+	policyOrderBeforeAnnotation = "terraform-provider-calico/order-before"
+)
+
+// policyPlacement serializes placing policies, so two policies don't take
+// the same gap
+var policyPlacement sync.Mutex
+
+// policyOrderAnnotations returns a copy of annotations that records c, or
+// drops the record when c isn't relative
+func policyOrderAnnotations(annotations map[string]string, c policyOrderConstraint) map[string]string {
+	recorded := make(map[string]string, len(annotations)+2)
+	for k, v := range annotations {
+		recorded[k] = v
+	}
+	delete(recorded, policyOrderAfterAnnotation)
+	delete(recorded, policyOrderBeforeAnnotation)
+
+	if len(c.after) > 0 {
+		recorded[policyOrderAfterAnnotation] = strings.Join(c.after, ",")
+	}
+	if len(c.before) > 0 {
+		recorded[policyOrderBeforeAnnotation] = strings.Join(c.before, ",")
+	}
+
+	if len(recorded) == 0 {
+		return nil
+	}
+	return recorded
+}
+
+// annotatedPolicyOrder returns the constraint recorded in annotations
+func annotatedPolicyOrder(annotations map[string]string) policyOrderConstraint {
+	c := policyOrderConstraint{}
+	if v := annotations[policyOrderAfterAnnotation]; v != "" {
+		c.after = strings.Split(v, ",")
+	}
+	if v := annotations[policyOrderBeforeAnnotation]; v != "" {
+		c.before = strings.Split(v, ",")
+	}
+	return c
+}
+
+// policyOrderCycle returns the policies of a cycle in constraints, in the
+// order they would have to be in, or nil when there is none
+func policyOrderCycle(constraints map[string]policyOrderConstraint) []string {
+	// an edge from a policy to one that comes after it
+	edges := make(map[string][]string)
+	for name, c := range constraints {
+		for _, a := range c.after {
+			edges[a] = append(edges[a], name)
+		}
+		edges[name] = append(edges[name], c.before...)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	path := []string{}
+
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return append(append([]string{}, path[i:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, next := range edges[name] {
+			if cycle := visit(next); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+
+		return nil
+	}
+
+	names := make([]string, 0, len(edges))
+	for name := range edges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if cycle := visit(name); cycle != nil {
+			return cycle
+		}
+	}
+
+	return nil
+}
+
+// policyOrderBounds returns the order policy name has to stay above and the
+// one it has to stay below, with whether there is such a bound
+func policyOrderBounds(name string, orders map[string]float64, c policyOrderConstraint) (lower float64, hasLower bool, upper float64, hasUpper bool, err error) {
+	for _, a := range c.after {
+		order, ok := orders[a]
+		if !ok {
+			return 0, false, 0, false, fmt.Errorf("policy %s comes after policy %s, which doesn't exist", name, a)
+		}
+		if !hasLower || order > lower {
+			lower, hasLower = order, true
+		}
+	}
+	for _, b := range c.before {
+		order, ok := orders[b]
+		if !ok {
+			return 0, false, 0, false, fmt.Errorf("policy %s comes before policy %s, which doesn't exist", name, b)
+		}
+		if !hasUpper || order < upper {
+			upper, hasUpper = order, true
+		}
+	}
+	if hasLower && hasUpper && upper <= lower {
+		return 0, false, 0, false, fmt.Errorf("policy %s can't come after %s and before %s, "+
+			"they have orders %v and %v", name, strings.Join(c.after, ", "), strings.Join(c.before, ", "), lower, upper)
+	}
+
+	return lower, hasLower, upper, hasUpper, nil
+}
+
+// resolvePolicyOrder returns the order of policy name that satisfies c,
+// given the orders of all policies. A current order that satisfies c is
+// kept. When there is no gap left, the policies from the upper bound on are
+// moved up, keeping their relative order; their new orders are returned.
+// Only movable policies are moved, when others are in the way there is no
+// room to make.
+func resolvePolicyOrder(name string, orders map[string]float64, c policyOrderConstraint, movable map[string]bool) (float64, map[string]float64, error) {
+	lower, hasLower, upper, hasUpper, err := policyOrderBounds(name, orders, c)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if current, ok := orders[name]; ok && (!hasLower || current > lower) && (!hasUpper || current < upper) {
+		return current, nil, nil
+	}
+
+	switch {
+	case !hasUpper:
+		return lower + policyOrderGap, nil, nil
+	case !hasLower:
+		return upper - policyOrderGap, nil, nil
+	case upper-lower > policyOrderMinGap:
+		return lower + (upper-lower)/2, nil, nil
+	}
+
+	shift := lower + 2*policyOrderGap - upper
+	moved := make(map[string]float64)
+	fixed := []string{}
+	for n, order := range orders {
+		switch {
+		case n == name || order < upper:
+		case movable[n]:
+			moved[n] = order + shift
+		default:
+			fixed = append(fixed, n)
+		}
+	}
+	if len(fixed) > 0 {
+		sort.Strings(fixed)
+		return 0, nil, fmt.Errorf("no gap between %s and %s for policy %s, and %s can't be moved to make room, "+
+			"only policies placed with order_after or order_before are", boundPolicy(c.after, orders, lower), boundPolicy(c.before, orders, upper),
+			name, strings.Join(fixed, ", "))
+	}
+
+	return lower + policyOrderGap, moved, nil
+}
+
+// boundPolicy returns the policy in names that has order
+func boundPolicy(names []string, orders map[string]float64, order float64) string {
+	for _, n := range names {
+		if orders[n] == order {
+			return n
+		}
+	}
+	return ""
+}
+
+func dToPolicyOrderConstraint(d *schema.ResourceData) policyOrderConstraint {
+	return policyOrderConstraint{
+		after:  toStringList(d.Get("spec.0.order_after").([]interface{})),
+		before: toStringList(d.Get("spec.0.order_before").([]interface{})),
+	}
+}
+
+func toStringList(values []interface{}) []string {
+	list := make([]string, len(values))
+	for i, v := range values {
+		list[i] = v.(string)
+	}
+	return list
+}
+
+// policyOrderGraph returns the orders of all policies in the datastore and
+// the constraints recorded on the relatively placed ones, with c as the
+// constraint of policy name. It fails when that closes a cycle.
+func policyOrderGraph(config config, name string, c policyOrderConstraint) (map[string]float64, map[string]policyOrderConstraint, error) {
+	policies, err := config.Client.Policies().List(api.PolicyMetadata{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	orders := make(map[string]float64)
+	constraints := make(map[string]policyOrderConstraint)
+	for _, policy := range policies.Items {
+		if policy.Spec.Order != nil {
+			orders[policy.Metadata.Name] = *policy.Spec.Order
+		}
+		if recorded := annotatedPolicyOrder(policy.Metadata.Annotations); recorded.relative() {
+			constraints[policy.Metadata.Name] = recorded
+		}
+	}
+	if c.relative() {
+		constraints[name] = c
+	} else {
+		delete(constraints, name)
+	}
+
+	if cycle := policyOrderCycle(constraints); cycle != nil {
+		return nil, nil, fmt.Errorf("policy order has a cycle: %s", strings.Join(cycle, " < "))
+	}
+	return orders, constraints, nil
+}
+
+// relativePolicies returns the policies with a recorded constraint, the
+// ones that may be moved to make room for others
+func relativePolicies(constraints map[string]policyOrderConstraint) map[string]bool {
+	relative := make(map[string]bool, len(constraints))
+	for name := range constraints {
+		relative[name] = true
+	}
+	return relative
+}
+
+// placePolicy sets the order of spec from the order_after and order_before
+// of the policy in d, moving other policies up when there's no room, and
+// records them in the annotations of metadata. The caller holds
+// policyPlacement until the policy is written.
+func placePolicy(d *schema.ResourceData, config config, metadata *api.PolicyMetadata, spec *api.PolicySpec) error {
+	c := dToPolicyOrderConstraint(d)
+	metadata.Annotations = policyOrderAnnotations(metadata.Annotations, c)
+	if !c.relative() {
+		return nil
+	}
+
+	orders, constraints, err := policyOrderGraph(config, metadata.Name, c)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	order, moved, err := resolvePolicyOrder(metadata.Name, orders, c, relativePolicies(constraints))
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	// move the highest policy first, so they never pass each other
+	names := make([]string, 0, len(moved))
+	for n := range moved {
+		names = append(names, n)
+	}
+	sort.Sort(sort.Reverse(policiesByOrder{names, moved}))
+	for _, n := range names {
+		if err := movePolicy(config, n, moved[n]); err != nil {
+			return fmt.Errorf("ERROR: moving policy %s to make room: %v", n, err)
+		}
+	}
+
+	spec.Order = &order
+	return nil
+}
+
+type policiesByOrder struct {
+	names  []string
+	orders map[string]float64
+}
+
+func (p policiesByOrder) Len() int           { return len(p.names) }
+func (p policiesByOrder) Swap(i, j int)      { p.names[i], p.names[j] = p.names[j], p.names[i] }
+func (p policiesByOrder) Less(i, j int) bool { return p.orders[p.names[i]] < p.orders[p.names[j]] }
+
+func movePolicy(config config, name string, order float64) error {
+	calicoClient, revisions := newRevisionClient(config.Client)
+	policies := calicoClient.Policies()
+
+	metadata := api.PolicyMetadata{Name: name}
+	policy, err := policies.Get(metadata)
+	if err != nil {
+		return err
+	}
+	revisions.hold()
+
+	log.Printf("[INFO] moving policy %s from order %v to %v", name, *policy.Spec.Order, order)
+	policy.Spec.Order = &order
+	config.cache.invalidate(policyCacheKey(metadata))
+	if _, err := policies.Apply(policy); err != nil {
+		return revisions.conflict(err)
+	}
+
+	return nil
+}
+
+// policyOrderDrift describes how the order of policy no longer satisfies
+// the order_after and order_before in d
+func policyOrderDrift(d *schema.ResourceData, config config, policy *api.Policy) (string, error) {
+	c := dToPolicyOrderConstraint(d)
+	if !c.relative() {
+		return "", nil
+	}
+
+	orders, constraints, err := policyOrderGraph(config, policy.Metadata.Name, c)
+	if err != nil {
+		return "", err
+	}
+	order, moved, err := resolvePolicyOrder(policy.Metadata.Name, orders, c, relativePolicies(constraints))
+	if err != nil {
+		return err.Error(), nil
+	}
+	if policy.Spec.Order == nil || order != *policy.Spec.Order || len(moved) > 0 {
+		place := []string{}
+		if len(c.after) > 0 {
+			place = append(place, "after "+strings.Join(c.after, ", "))
+		}
+		if len(c.before) > 0 {
+			place = append(place, "before "+strings.Join(c.before, ", "))
+		}
+		return "order is no longer " + strings.Join(place, " and "), nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,303 @@
+package calico
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	"github.com/projectcalico/libcalico-go/lib/client"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+)
+
+func TestResolvePolicyOrder(t *testing.T) {
+	relative := map[string]bool{"b": true, "c": true}
+
+	cases := []struct {
+		orders   map[string]float64
+		c        policyOrderConstraint
+		movable  map[string]bool
+		expected float64
+		moved    map[string]float64
+		err      string
+	}{
+		// placed after, before or between the referenced policies
+		{map[string]float64{"a": 100}, policyOrderConstraint{after: []string{"a"}}, nil, 200, nil, ""},
+		{map[string]float64{"b": 100}, policyOrderConstraint{before: []string{"b"}}, nil, 0, nil, ""},
+		{map[string]float64{"a": 100, "b": 200}, policyOrderConstraint{after: []string{"a"}, before: []string{"b"}}, nil, 150, nil, ""},
+		{map[string]float64{"a": 100, "a2": 150, "b": 200}, policyOrderConstraint{after: []string{"a", "a2"}, before: []string{"b"}}, nil, 175, nil, ""},
+		// a current order in place is kept
+		{map[string]float64{"a": 100, "b": 200, "p": 110}, policyOrderConstraint{after: []string{"a"}, before: []string{"b"}}, nil, 110, nil, ""},
+		{map[string]float64{"a": 100, "b": 200, "p": 300}, policyOrderConstraint{after: []string{"a"}, before: []string{"b"}}, nil, 150, nil, ""},
+		// no gap left, the relatively placed policies from b on move up
+		{map[string]float64{"a": 100, "b": 100.5, "c": 300, "z": 50}, policyOrderConstraint{after: []string{"a"}, before: []string{"b"}}, relative, 200,
+			map[string]float64{"b": 300, "c": 499.5}, ""},
+		// the policy being placed isn't in the way
+		{map[string]float64{"a": 100, "b": 100.5, "c": 300, "p": 500}, policyOrderConstraint{after: []string{"a"}, before: []string{"b"}}, relative, 200,
+			map[string]float64{"b": 300, "c": 499.5}, ""},
+		// policies with a fixed order are never moved
+		{map[string]float64{"a": 100, "b": 100.5, "c": 300, "d": 400}, policyOrderConstraint{after: []string{"a"}, before: []string{"b"}}, relative, 0,
+			nil, "no gap between a and b for policy p, and d can't be moved"},
+		{map[string]float64{"a": 100, "b": 100.5}, policyOrderConstraint{after: []string{"a"}, before: []string{"b"}}, nil, 0,
+			nil, "no gap between a and b for policy p, and b can't be moved"},
+		{map[string]float64{"a": 100}, policyOrderConstraint{after: []string{"x"}}, nil, 0, nil, "doesn't exist"},
+		{map[string]float64{"a": 200, "b": 100}, policyOrderConstraint{after: []string{"a"}, before: []string{"b"}}, nil, 0, nil, "can't come after"},
+	}
+
+	for _, c := range cases {
+		order, moved, err := resolvePolicyOrder("p", c.orders, c.c, c.movable)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("resolvePolicyOrder(%v, %v) returned error %v, expected %q", c.orders, c.c, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolvePolicyOrder(%v, %v) returned error %v", c.orders, c.c, err)
+			continue
+		}
+		if order != c.expected || (len(moved) > 0 || len(c.moved) > 0) && !reflect.DeepEqual(moved, c.moved) {
+			t.Errorf("resolvePolicyOrder(%v, %v) = %v, %v, expected %v, %v", c.orders, c.c, order, moved, c.expected, c.moved)
+		}
+	}
+}
+
+func TestPolicyOrderCycle(t *testing.T) {
+	cases := []struct {
+		constraints map[string]policyOrderConstraint
+		expected    []string
+	}{
+		{map[string]policyOrderConstraint{
+			"b": {after: []string{"a"}},
+			"c": {after: []string{"b"}, before: []string{"d"}},
+		}, nil},
+		{map[string]policyOrderConstraint{
+			"a": {after: []string{"a"}},
+		}, []string{"a", "a"}},
+		{map[string]policyOrderConstraint{
+			"b": {after: []string{"a"}},
+			"c": {after: []string{"b"}},
+			"a": {after: []string{"c"}},
+		}, []string{"a", "b", "c", "a"}},
+		{map[string]policyOrderConstraint{
+			"b": {after: []string{"a"}},
+			"a": {after: []string{"c"}},
+			"c": {before: []string{"d"}},
+			"d": {before: []string{"b"}},
+		}, nil},
+		{map[string]policyOrderConstraint{
+			"a": {before: []string{"b"}},
+			"b": {before: []string{"a"}},
+		}, []string{"a", "b", "a"}},
+	}
+
+	for _, c := range cases {
+		if cycle := policyOrderCycle(c.constraints); !reflect.DeepEqual(cycle, c.expected) {
+			t.Errorf("policyOrderCycle(%v) = %v, expected %v", c.constraints, cycle, c.expected)
+		}
+	}
+}
+
+// testPolicyBackend is a datastore of policies that rejects writes
+// conditional on an old revision
+type testPolicyBackend struct {
+	bapi.Client
+
+	policies map[string]*model.KVPair
+	writes   int
+}
+
+// newTestPolicyBackend returns a datastore with policies at orders, the
+// relatively placed ones recording their constraints
+func newTestPolicyBackend(orders map[string]float64, constraints map[string]policyOrderConstraint) *testPolicyBackend {
+	b := &testPolicyBackend{policies: make(map[string]*model.KVPair)}
+	for name, order := range orders {
+		order := order
+		b.policies[name] = &model.KVPair{
+			Key: model.PolicyKey{Name: name},
+			Value: &model.Policy{
+				Order:       &order,
+				Selector:    "all()",
+				Annotations: policyOrderAnnotations(nil, constraints[name]),
+			},
+			Revision: uint64(1),
+		}
+	}
+	return b
+}
+
+func (b *testPolicyBackend) orders() map[string]float64 {
+	orders := make(map[string]float64)
+	for name, kvp := range b.policies {
+		orders[name] = *kvp.Value.(*model.Policy).Order
+	}
+	return orders
+}
+
+func (b *testPolicyBackend) Get(key model.Key) (*model.KVPair, error) {
+	kvp, ok := b.policies[key.(model.PolicyKey).Name]
+	if !ok {
+		return nil, errors.ErrorResourceDoesNotExist{Identifier: key}
+	}
+	return &model.KVPair{Key: kvp.Key, Value: kvp.Value, Revision: kvp.Revision}, nil
+}
+
+func (b *testPolicyBackend) List(list model.ListInterface) ([]*model.KVPair, error) {
+	kvps := []*model.KVPair{}
+	for _, kvp := range b.policies {
+		kvps = append(kvps, &model.KVPair{Key: kvp.Key, Value: kvp.Value, Revision: kvp.Revision})
+	}
+	return kvps, nil
+}
+
+func (b *testPolicyBackend) Update(object *model.KVPair) (*model.KVPair, error) {
+	name := object.Key.(model.PolicyKey).Name
+	existing, ok := b.policies[name]
+	if !ok {
+		return nil, errors.ErrorResourceDoesNotExist{Identifier: object.Key}
+	}
+	if object.Revision != nil && object.Revision != existing.Revision {
+		return nil, errors.ErrorResourceUpdateConflict{Identifier: object.Key}
+	}
+	b.writes++
+	b.policies[name] = &model.KVPair{Key: object.Key, Value: object.Value, Revision: existing.Revision.(uint64) + 1}
+	return b.policies[name], nil
+}
+
+func (b *testPolicyBackend) Apply(object *model.KVPair) (*model.KVPair, error) {
+	if _, ok := b.policies[object.Key.(model.PolicyKey).Name]; !ok {
+		b.writes++
+		b.policies[object.Key.(model.PolicyKey).Name] = &model.KVPair{Key: object.Key, Value: object.Value, Revision: uint64(1)}
+		return object, nil
+	}
+	object.Revision = nil
+	return b.Update(object)
+}
+
+func testPolicyOrderData(t *testing.T, name string, after, before []interface{}) *schema.ResourceData {
+	return schema.TestResourceDataRaw(t, resourceCalicoPolicy().Schema, map[string]interface{}{
+		"name": name,
+		"spec": []interface{}{map[string]interface{}{
+			"order_after":  after,
+			"order_before": before,
+		}},
+	})
+}
+
+func TestPlacePolicy(t *testing.T) {
+	// b and c were placed relatively, by this or another configuration
+	backend := newTestPolicyBackend(map[string]float64{"a": 100, "b": 100.5, "c": 300, "z": 50}, map[string]policyOrderConstraint{
+		"b": {after: []string{"a"}},
+		"c": {after: []string{"b"}},
+	})
+	config := config{Client: &client.Client{Backend: backend}}
+
+	metadata := api.PolicyMetadata{Name: "p", Annotations: map[string]string{"owner": "someone-else"}}
+	spec := api.PolicySpec{}
+	if err := placePolicy(testPolicyOrderData(t, "p", []interface{}{"a"}, []interface{}{"b"}), config, &metadata, &spec); err != nil {
+		t.Fatalf("placePolicy: %v", err)
+	}
+	if spec.Order == nil || *spec.Order != 200 {
+		t.Fatalf("expected order 200, got %v", spec.Order)
+	}
+	expectedAnnotations := map[string]string{"owner": "someone-else", policyOrderAfterAnnotation: "a", policyOrderBeforeAnnotation: "b"}
+	if !reflect.DeepEqual(metadata.Annotations, expectedAnnotations) {
+		t.Fatalf("expected annotations %v, got %v", expectedAnnotations, metadata.Annotations)
+	}
+	expected := map[string]float64{"a": 100, "b": 300, "c": 499.5, "z": 50}
+	if orders := backend.orders(); !reflect.DeepEqual(orders, expected) {
+		t.Fatalf("expected the policies from b on to move up to %v, got %v", expected, orders)
+	}
+
+	// a policy that's in place stays, without writes
+	backend.policies["p"] = &model.KVPair{Key: model.PolicyKey{Name: "p"}, Value: &model.Policy{Order: spec.Order, Annotations: metadata.Annotations}, Revision: uint64(1)}
+	writes := backend.writes
+	metadata = api.PolicyMetadata{Name: "p"}
+	spec = api.PolicySpec{}
+	if err := placePolicy(testPolicyOrderData(t, "p", []interface{}{"a"}, []interface{}{"b"}), config, &metadata, &spec); err != nil {
+		t.Fatalf("placePolicy: %v", err)
+	}
+	if *spec.Order != 200 || backend.writes != writes {
+		t.Fatalf("expected p to stay at 200 without writes, got %v after %d writes", *spec.Order, backend.writes-writes)
+	}
+}
+
+func TestPlacePolicy_noGap(t *testing.T) {
+	// c has a fixed order, so there's no room to make between a and b
+	backend := newTestPolicyBackend(map[string]float64{"a": 100, "b": 100.5, "c": 300}, map[string]policyOrderConstraint{
+		"b": {after: []string{"a"}},
+	})
+	config := config{Client: &client.Client{Backend: backend}}
+
+	spec := api.PolicySpec{}
+	err := placePolicy(testPolicyOrderData(t, "p", []interface{}{"a"}, []interface{}{"b"}), config, &api.PolicyMetadata{Name: "p"}, &spec)
+	if err == nil || !strings.Contains(err.Error(), "no gap between a and b") {
+		t.Fatalf("expected a no gap error, got %v", err)
+	}
+	if backend.writes != 0 {
+		t.Fatalf("expected no policy to be moved, got %d writes", backend.writes)
+	}
+}
+
+func TestPlacePolicy_cycle(t *testing.T) {
+	// a was placed after p by another configuration, which only the
+	// datastore knows about
+	backend := newTestPolicyBackend(map[string]float64{"a": 100, "b": 300}, map[string]policyOrderConstraint{
+		"a": {after: []string{"p"}},
+	})
+	config := config{Client: &client.Client{Backend: backend}}
+
+	spec := api.PolicySpec{}
+	err := placePolicy(testPolicyOrderData(t, "p", []interface{}{"a"}, nil), config, &api.PolicyMetadata{Name: "p"}, &spec)
+	if err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+	if backend.writes != 0 {
+		t.Fatalf("expected no writes, got %d", backend.writes)
+	}
+}
+
+func TestPlacePolicy_fixedOrder(t *testing.T) {
+	backend := newTestPolicyBackend(map[string]float64{"a": 100}, nil)
+	config := config{Client: &client.Client{Backend: backend}}
+
+	// a policy with a fixed order drops a constraint it recorded before
+	metadata := api.PolicyMetadata{Name: "p", Annotations: policyOrderAnnotations(nil, policyOrderConstraint{after: []string{"a"}})}
+	spec := api.PolicySpec{}
+	if err := placePolicy(testPolicyOrderData(t, "p", nil, nil), config, &metadata, &spec); err != nil {
+		t.Fatalf("placePolicy: %v", err)
+	}
+	if metadata.Annotations != nil || spec.Order != nil {
+		t.Fatalf("expected no annotations and no order, got %v and %v", metadata.Annotations, spec.Order)
+	}
+}
+
+func TestAnnotatedPolicyOrder(t *testing.T) {
+	c := policyOrderConstraint{after: []string{"a", "b"}, before: []string{"c"}}
+	if recorded := annotatedPolicyOrder(policyOrderAnnotations(nil, c)); !reflect.DeepEqual(recorded, c) {
+		t.Fatalf("expected %v, got %v", c, recorded)
+	}
+	if recorded := annotatedPolicyOrder(map[string]string{"owner": "someone-else"}); recorded.relative() {
+		t.Fatalf("expected no constraint, got %v", recorded)
+	}
+}
+
+func TestMovePolicy(t *testing.T) {
+	backend := newTestPolicyBackend(map[string]float64{"a": 100}, nil)
+	config := config{Client: &client.Client{Backend: backend}}
+
+	if err := movePolicy(config, "a", 250); err != nil {
+		t.Fatalf("movePolicy: %v", err)
+	}
+	policy := backend.policies["a"].Value.(*model.Policy)
+	if *policy.Order != 250 || policy.Selector != "all()" {
+		t.Fatalf("expected a to move to 250 and keep its selector, got order %v and selector %q", *policy.Order, policy.Selector)
+	}
+
+	if err := movePolicy(config, "missing", 250); err == nil {
+		t.Fatalf("expected moving a missing policy to fail")
+	}
+}
@@ -12,7 +12,7 @@ import (
 
 // Provider is the provider for terraform
 func Provider() terraform.ResourceProvider {
-	return &schema.Provider{
+	return &checkedProvider{&schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"backend_type": &schema.Schema{
 				Type:        schema.TypeString,
@@ -104,19 +104,94 @@ func Provider() terraform.ResourceProvider {
 				Default:     "",
 				Description: "K8sToken",
 			},
+			"max_concurrent_requests": &schema.Schema{
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     0,
+				Description: "maximum number of datastore requests in flight, 0 means unlimited",
+			},
+			"requests_per_second": &schema.Schema{
+				Type:        schema.TypeFloat,
+				Optional:    true,
+				Default:     0.0,
+				Description: "maximum number of datastore requests started per second, 0 means unlimited",
+			},
+			"read_cache": &schema.Schema{
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "serve reads from one list per kind instead of one get per resource",
+			},
+			"update_mode": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      updateModeReplace,
+				ValidateFunc: validateUpdateMode(false),
+				Description:  "replace writes complete objects, merge only the attributes set in config",
+			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      adoptNever,
+				ValidateFunc: validateAdoptExisting(false),
+				Description:  "never fails to create existing objects, strict adopts them when they match the config, reconcile overwrites them",
+			},
+			"reserved_cidrs": &schema.Schema{
+				Type:        schema.TypeList,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "ranges IP pools may not overlap with, like service and host networks",
+			},
+		},
+
+		DataSourcesMap: map[string]*schema.Resource{
+			"calico_ippool_next_free_cidr": dataSourceCalicoIpPoolNextFreeCidr(),
+			"calico_ipam_leaks":            dataSourceCalicoIpamLeaks(),
+			"calico_router_config":         dataSourceCalicoRouterConfig(),
+			"calico_rule_set":              dataSourceCalicoRuleSet(),
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
-			"calico_hostendpoint": resourceCalicoHostendpoint(),
-			"calico_profile":      resourceCalicoProfile(),
-			"calico_policy":       resourceCalicoPolicy(),
-			"calico_ippool":       resourceCalicoIpPool(),
-			"calico_bgppeer":      resourceCalicoBgpPeer(),
-			"calico_node":         resourceCalicoNode(),
+			"calico_hostendpoint":             resourceCalicoHostendpoint(),
+			"calico_hostendpoints":            resourceCalicoHostendpoints(),
+			"calico_hostendpoint_labels":      resourceCalicoHostendpointLabels(),
+			"calico_profile":                  resourceCalicoProfile(),
+			"calico_policy":                   resourceCalicoPolicy(),
+			"calico_policy_rule":              resourceCalicoPolicyRule(),
+			"calico_ippool":                   resourceCalicoIpPool(),
+			"calico_bgppeer":                  resourceCalicoBgpPeer(),
+			"calico_bgppeer_group":            resourceCalicoBgpPeerGroup(),
+			"calico_node":                     resourceCalicoNode(),
+			"calico_node_ready":               resourceCalicoNodeReady(),
+			"calico_ipam_block_affinity":      resourceCalicoIpamBlockAffinity(),
+			"calico_ipam_leak_release":        resourceCalicoIpamLeakRelease(),
+			"calico_route_reflector_topology": resourceCalicoRouteReflectorTopology(),
 		},
 
 		ConfigureFunc: providerConfigure,
+	}}
+}
+
+// checkedProvider adds the plan time checks that span several attributes of
+// a resource, which helper/schema has no hook for
+type checkedProvider struct {
+	*schema.Provider
+}
+
+// resourceConfigChecks are the plan time checks by resource type
+var resourceConfigChecks = map[string]func(c *terraform.ResourceConfig) []error{
+	"calico_ippool":        checkIpPoolConfig,
+	"calico_bgppeer":       checkBgpPeerConfig,
+	"calico_bgppeer_group": checkBgpPeerGroupConfig,
+	"calico_hostendpoint":  checkHostEndpointConfig,
+}
+
+func (p *checkedProvider) ValidateResource(t string, c *terraform.ResourceConfig) ([]string, []error) {
+	ws, es := p.Provider.ValidateResource(t, c)
+	if check, ok := resourceConfigChecks[t]; ok && len(es) == 0 {
+		es = append(es, check(c)...)
 	}
+	return ws, es
 }
 
 func providerConfigure(d *schema.ResourceData) (interface{}, error) {
@@ -156,8 +231,29 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	}
 
 	config := config{
-		config: calicoConfig,
-		Client: calicoClient,
+		config:        calicoConfig,
+		Client:        calicoClient,
+		updateMode:    d.Get("update_mode").(string),
+		adoptExisting: d.Get("adopt_existing").(string),
+	}
+
+	maxConcurrent := d.Get("max_concurrent_requests").(int)
+	perSecond := d.Get("requests_per_second").(float64)
+	if maxConcurrent < 0 || perSecond < 0 {
+		return nil, fmt.Errorf("max_concurrent_requests and requests_per_second can't be negative")
+	}
+	if maxConcurrent > 0 || perSecond > 0 {
+		config.limiter = newRequestLimiter(maxConcurrent, perSecond)
+	}
+
+	reservedCIDRs, err := parseReservedCIDRs(d.Get("reserved_cidrs").([]interface{}))
+	if err != nil {
+		return nil, err
+	}
+	config.reservedCIDRs = reservedCIDRs
+
+	if d.Get("read_cache").(bool) {
+		config.cache = newReadCache()
 	}
 
 	log.Printf("Configured: %#v", config)
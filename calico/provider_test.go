@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	tfconfig "github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
@@ -12,14 +13,14 @@ var testAccProviders map[string]terraform.ResourceProvider
 var testAccProvider *schema.Provider
 
 func init() {
-	testAccProvider = Provider().(*schema.Provider)
+	testAccProvider = Provider().(*checkedProvider).Provider
 	testAccProviders = map[string]terraform.ResourceProvider{
-		"calico": testAccProvider,
+		"calico": &checkedProvider{testAccProvider},
 	}
 }
 
 func TestProvider(t *testing.T) {
-	if err := Provider().(*schema.Provider).InternalValidate(); err != nil {
+	if err := Provider().(*checkedProvider).InternalValidate(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 }
@@ -28,6 +29,112 @@ func TestProvider_impl(t *testing.T) {
 	var _ terraform.ResourceProvider = Provider()
 }
 
+func TestProvider_ipPoolConfigCheck(t *testing.T) {
+	cases := []struct {
+		raw   map[string]interface{}
+		valid bool
+	}{
+		{map[string]interface{}{"cidr": "10.1.0.0/16", "spec": []interface{}{
+			map[string]interface{}{"ipip": []interface{}{map[string]interface{}{"enabled": true}}},
+		}}, true},
+		{map[string]interface{}{"cidr": "fd80:24e2::/64", "spec": []interface{}{
+			map[string]interface{}{"ipip": []interface{}{map[string]interface{}{"enabled": false}}},
+		}}, true},
+		{map[string]interface{}{"cidr": "fd80:24e2::/64"}, true},
+		{map[string]interface{}{"cidr": "fd80:24e2::/64", "spec": []interface{}{
+			map[string]interface{}{"ipip": []interface{}{map[string]interface{}{"enabled": true}}},
+		}}, false},
+	}
+
+	for _, c := range cases {
+		rawConfig, err := tfconfig.NewRawConfig(c.raw)
+		if err != nil {
+			t.Fatalf("raw config: %v", err)
+		}
+		_, es := Provider().ValidateResource("calico_ippool", terraform.NewResourceConfig(rawConfig))
+		if valid := len(es) == 0; valid != c.valid {
+			t.Errorf("validating %v returned %v, expected valid %v", c.raw, es, c.valid)
+		}
+	}
+}
+
+func TestProvider_bgpPeerConfigCheck(t *testing.T) {
+	cases := []struct {
+		raw   map[string]interface{}
+		valid bool
+	}{
+		{map[string]interface{}{"scope": "node", "node": "node1", "peerIP": "10.0.0.1"}, true},
+		{map[string]interface{}{"scope": "global", "peerIP": "10.0.0.1"}, true},
+		{map[string]interface{}{"scope": "node", "peerIP": "10.0.0.1"}, false},
+		{map[string]interface{}{"scope": "global", "node": "node1", "peerIP": "10.0.0.1"}, false},
+	}
+
+	for _, c := range cases {
+		rawConfig, err := tfconfig.NewRawConfig(c.raw)
+		if err != nil {
+			t.Fatalf("raw config: %v", err)
+		}
+		_, es := Provider().ValidateResource("calico_bgppeer", terraform.NewResourceConfig(rawConfig))
+		if valid := len(es) == 0; valid != c.valid {
+			t.Errorf("validating %v returned %v, expected valid %v", c.raw, es, c.valid)
+		}
+	}
+}
+
+func TestProvider_bgpPeerGroupConfigCheck(t *testing.T) {
+	cases := []struct {
+		raw   map[string]interface{}
+		valid bool
+	}{
+		{map[string]interface{}{"name": "tor", "peer_ips": []interface{}{"10.0.0.1"}, "as_number": "64512", "node_regex": "^rack1-"}, true},
+		{map[string]interface{}{"name": "tor", "peer_ips": []interface{}{"10.0.0.1"}, "as_number": "64512", "nodes": []interface{}{"node1"}}, true},
+		{map[string]interface{}{"name": "tor", "peer_ips": []interface{}{"10.0.0.1"}, "as_number": "64512"}, false},
+		{map[string]interface{}{"name": "tor", "peer_ips": []interface{}{"10.0.0.1"}, "as_number": "64512", "node_regex": "^rack1-", "nodes": []interface{}{"node1"}}, false},
+	}
+
+	for _, c := range cases {
+		rawConfig, err := tfconfig.NewRawConfig(c.raw)
+		if err != nil {
+			t.Fatalf("raw config: %v", err)
+		}
+		_, es := Provider().ValidateResource("calico_bgppeer_group", terraform.NewResourceConfig(rawConfig))
+		if valid := len(es) == 0; valid != c.valid {
+			t.Errorf("validating %v returned %v, expected valid %v", c.raw, es, c.valid)
+		}
+	}
+}
+
+func TestProvider_hostEndpointConfigCheck(t *testing.T) {
+	port := func(name string) map[string]interface{} {
+		return map[string]interface{}{"name": name, "protocol": "tcp", "port": 80}
+	}
+	cases := []struct {
+		raw   map[string]interface{}
+		valid bool
+	}{
+		{map[string]interface{}{"name": "eth0", "node": "node1", "interface": "eth0"}, true},
+		{map[string]interface{}{"name": "eth0", "node": "node1", "expected_ips": []interface{}{"10.0.0.1"}}, true},
+		{map[string]interface{}{"name": "eth0", "node": "node1"}, false},
+		{map[string]interface{}{"name": "eth0", "node": "node1", "interface": "eth0",
+			"ports": []interface{}{port("http"), port("https")}}, true},
+		{map[string]interface{}{"name": "eth0", "node": "node1", "interface": "eth0",
+			"ports": []interface{}{port("http"), port("http")}}, false},
+		{map[string]interface{}{"name": "eth0", "node": "node1", "interface": "eth0",
+			"ports": []interface{}{port("HTTP")}}, false},
+	}
+
+	for _, c := range cases {
+		rawConfig, err := tfconfig.NewRawConfig(c.raw)
+		if err != nil {
+			t.Fatalf("raw config: %v", err)
+		}
+		_, es := Provider().ValidateResource("calico_hostendpoint", terraform.NewResourceConfig(rawConfig))
+		if valid := len(es) == 0; valid != c.valid {
+			t.Errorf("validating %v returned %v, expected valid %v", c.raw, es, c.valid)
+		}
+	}
+}
+
 func testAccPreCheck(t *testing.T) {
 	if v := os.Getenv("CALICO_BACKEND_ETCD_AUTHORITY"); v == "" {
 		t.Fatal("CALICO_BACKEND_ETCD_AUTHORITY must be set for the acceptance tests to work.")
@@ -5,6 +5,7 @@ import (
 	"net"
 
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
 	"github.com/projectcalico/libcalico-go/lib/api"
 	"github.com/projectcalico/libcalico-go/lib/errors"
 	caliconet "github.com/projectcalico/libcalico-go/lib/net"
@@ -21,16 +22,22 @@ func resourceCalicoBgpPeer() *schema.Resource {
 
 		Schema: map[string]*schema.Schema{
 			"scope": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateBgpPeerScope,
 			},
 			"node": &schema.Schema{
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
+				ForceNew: true,
 			},
 			"peerIP": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateIP,
+				StateFunc:    normalizeIP,
 			},
 			"spec": &schema.Schema{
 				Type:     schema.TypeList,
@@ -39,31 +46,97 @@ func resourceCalicoBgpPeer() *schema.Resource {
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"asNumber": &schema.Schema{
-							Type:     schema.TypeString,
-							Required: true,
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validateASNumber,
 						},
 					},
 				},
 			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateAdoptExisting(true),
+			},
+			"revision": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"overwrite_on_conflict": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
 		},
 	}
 }
 
-func dToBgpPeerMetadata(d *schema.ResourceData) (api.BGPPeerMetadata, error) {
+func validateBgpPeerScope(v interface{}, k string) (ws []string, es []error) {
+	switch scope.Scope(v.(string)) {
+	case scope.Node, scope.Global:
+	default:
+		es = append(es, fmt.Errorf("%s must be %q or %q, got %q", k, scope.Node, scope.Global, v))
+	}
+	return
+}
 
+// checkBgpPeerConfig requires a node on node scoped peers and none on global
+// ones at plan time
+func checkBgpPeerConfig(c *terraform.ResourceConfig) []error {
+	if c.IsComputed("scope") || c.IsComputed("node") {
+		return nil
+	}
+	s, _ := c.Get("scope")
+	node, _ := c.Get("node")
+	hasNode := node != nil && fmt.Sprint(node) != ""
+
+	switch scope.Scope(fmt.Sprint(s)) {
+	case scope.Node:
+		if !hasNode {
+			return []error{fmt.Errorf("node is required for node scoped BGP peers")}
+		}
+	case scope.Global:
+		if hasNode {
+			return []error{fmt.Errorf("node can't be set on global BGP peers")}
+		}
+	}
+	return nil
+}
+
+func dToBgpPeerMetadata(d *schema.ResourceData) (api.BGPPeerMetadata, error) {
 	metadata := api.BGPPeerMetadata{
-		Node: d.Get("node").(string),
+		Scope: scope.Scope(d.Get("scope").(string)),
+		Node:  d.Get("node").(string),
 	}
 
-	pIP := d.Get("peerIP").(string)
-	peerIP := caliconet.IP{net.ParseIP(pIP)}
-	metadata.PeerIP = peerIP
+	// node scoped peers belong to a node, global ones to all of them
+	if metadata.Scope == scope.Node && metadata.Node == "" {
+		return metadata, fmt.Errorf("ERROR: node is required for node scoped BGP peers")
+	}
+	if metadata.Scope == scope.Global && metadata.Node != "" {
+		return metadata, fmt.Errorf("ERROR: node can't be set on global BGP peers")
+	}
 
-	metadata.Scope = scope.Scope(d.Get("scope").(string))
+	pIP := d.Get("peerIP").(string)
+	peerIP := net.ParseIP(pIP)
+	if peerIP == nil {
+		return metadata, fmt.Errorf("ERROR: couldn't parse peerIP %q", pIP)
+	}
+	metadata.PeerIP = caliconet.IP{peerIP}
 
 	return metadata, nil
 }
 
+// bgpPeerId identifies node scoped peers by scope, node and peer IP, global
+// peers by scope and peer IP
+func bgpPeerId(metadata api.BGPPeerMetadata) string {
+	if metadata.Scope == scope.Global {
+		return string(metadata.Scope) + "_" + metadata.PeerIP.String()
+	}
+	return string(metadata.Scope) + "_" + metadata.Node + "_" + metadata.PeerIP.String()
+}
+
 func dToBgpPeerSpec(d *schema.ResourceData) (api.BGPPeerSpec, error) {
 	spec := api.BGPPeerSpec{}
 
@@ -103,35 +176,59 @@ func resourceCalicoBgpPeerCreate(d *schema.ResourceData, meta interface{}) error
 	}
 
 	bgpPeers := calicoClient.BGPPeers()
+	config.cache.invalidate(bgpPeerCacheKey(metadata))
 	if _, err = bgpPeers.Create(&api.BGPPeer{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		if _, ok := err.(errors.ErrorResourceAlreadyExists); !ok || config.adoptMode(d) == adoptNever {
+			return err
+		}
+		if err := adoptBGPPeer(d, config, metadata, spec); err != nil {
+			return err
+		}
 	}
 
-	compoundID := string(metadata.Scope) + "_" + metadata.Node + "_" + metadata.PeerIP.String()
-	d.SetId(compoundID)
+	d.SetId(bgpPeerId(metadata))
 	return resourceCalicoBgpPeerRead(d, meta)
 }
 
-func resourceCalicoBgpPeerRead(d *schema.ResourceData, meta interface{}) error {
-	config := meta.(config)
-	calicoClient := config.Client
-
+// take over an existing BGPPeer instead of creating it
+func adoptBGPPeer(d *schema.ResourceData, config config, metadata api.BGPPeerMetadata, spec api.BGPPeerSpec) error {
+	calicoClient, revisions := config.conditionalClient(d)
 	bgpPeers := calicoClient.BGPPeers()
 
-	ip := d.Get("peerIP").(string)
-	resourcePeerIP := caliconet.IP{net.ParseIP(ip)}
+	existing, err := bgpPeers.Get(metadata)
+	if err != nil {
+		return err
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+
+	write, err := config.adopt(d, "BGP peer "+bgpPeerId(metadata), existing.Metadata, existing.Spec, metadata, spec)
+	if err != nil || !write {
+		return err
+	}
 
-	resourceNode := d.Get("node").(string)
-	resourceScope := scope.Scope(d.Get("scope").(string))
+	if _, err = bgpPeers.Apply(&api.BGPPeer{
+		Metadata: metadata,
+		Spec:     spec,
+	}); err != nil {
+		return revisions.conflict(err)
+	}
 
-	bgpPeer, err := bgpPeers.Get(api.BGPPeerMetadata{
-		Scope:  resourceScope,
-		Node:   resourceNode,
-		PeerIP: resourcePeerIP,
-	})
+	return nil
+}
+
+func resourceCalicoBgpPeerRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	metadata, err := dToBgpPeerMetadata(d)
+	if err != nil {
+		return err
+	}
+	bgpPeer, revision, err := config.getBGPPeer(metadata)
 
 	// Handle endpoint does not exist
 	if err != nil {
@@ -139,19 +236,23 @@ func resourceCalicoBgpPeerRead(d *schema.ResourceData, meta interface{}) error {
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
 	}
 
-	compoundID := d.Get("scope").(string) + "_" + d.Get("node").(string) + "_" + d.Get("peerIP").(string)
-	d.SetId(compoundID)
+	d.SetId(bgpPeerId(bgpPeer.Metadata))
+	d.Set("scope", string(bgpPeer.Metadata.Scope))
+	d.Set("node", bgpPeer.Metadata.Node)
+	d.Set("peerIP", bgpPeer.Metadata.PeerIP.String())
 
 	setSchemaFieldsForBGPPeerSpec(bgpPeer, d)
+	d.Set("revision", revision)
 
 	return nil
 }
 
 func resourceCalicoBgpPeerUpdate(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	bgpPeers := calicoClient.BGPPeers()
 
@@ -165,6 +266,10 @@ func resourceCalicoBgpPeerUpdate(d *schema.ResourceData, meta interface{}) error
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
 	}
 
 	// Simply recreate the complete resource
@@ -173,37 +278,43 @@ func resourceCalicoBgpPeerUpdate(d *schema.ResourceData, meta interface{}) error
 		return err
 	}
 
+	config.cache.invalidate(bgpPeerCacheKey(metadata))
 	if _, err = bgpPeers.Apply(&api.BGPPeer{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		return revisions.conflict(err)
 	}
 
-	return nil
+	return resourceCalicoBgpPeerRead(d, meta)
 }
 
 func resourceCalicoBgpPeerDelete(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	bgpPeers := calicoClient.BGPPeers()
 
-	ip := d.Get("peerIP").(string)
-	resourcePeerIP := caliconet.IP{net.ParseIP(ip)}
-
-	resourceNode := d.Get("node").(string)
-	resourceScope := scope.Scope(d.Get("scope").(string))
+	metadata, err := dToBgpPeerMetadata(d)
+	if err != nil {
+		return err
+	}
+	if _, err := bgpPeers.Get(metadata); err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
 
-	err := bgpPeers.Delete(api.BGPPeerMetadata{
-		Scope:  resourceScope,
-		Node:   resourceNode,
-		PeerIP: resourcePeerIP,
-	})
+	config.cache.invalidate(bgpPeerCacheKey(metadata))
+	err = bgpPeers.Delete(metadata)
 
 	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
-			return fmt.Errorf("ERROR: %v", err)
+			return fmt.Errorf("ERROR: %v", revisions.conflict(err))
 		}
 	}
 
@@ -0,0 +1,366 @@
+package calico
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+	"github.com/projectcalico/libcalico-go/lib/scope"
+)
+
+func resourceCalicoBgpPeerGroup() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCalicoBgpPeerGroupCreate,
+		Read:   resourceCalicoBgpPeerGroupRead,
+		Update: resourceCalicoBgpPeerGroupUpdate,
+		Delete: resourceCalicoBgpPeerGroupDelete,
+
+		Schema: map[string]*schema.Schema{
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"peer_ips": &schema.Schema{
+				Type:     schema.TypeList,
+				Required: true,
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validateIP,
+				},
+			},
+			"as_number": &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateASNumber,
+			},
+			"node_regex": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateRegexp,
+			},
+			"nodes": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateAdoptExisting(true),
+			},
+			"peers": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"drift": driftSchema(),
+		},
+	}
+}
+
+// a group's peers are keyed by node and peer IP
+func bgpPeerGroupKey(metadata api.BGPPeerMetadata) string {
+	return metadata.Node + "/" + metadata.PeerIP.String()
+}
+
+func bgpPeerGroupMetadata(key string) api.BGPPeerMetadata {
+	i := strings.LastIndex(key, "/")
+
+	return api.BGPPeerMetadata{
+		Scope:  scope.Node,
+		Node:   key[:i],
+		PeerIP: caliconet.IP{net.ParseIP(key[i+1:])},
+	}
+}
+
+// checkBgpPeerGroupConfig requires exactly one of node_regex and nodes at
+// plan time
+func checkBgpPeerGroupConfig(c *terraform.ResourceConfig) []error {
+	if c.IsComputed("node_regex") || c.IsComputed("nodes") {
+		return nil
+	}
+	nodeRegex, _ := c.Get("node_regex")
+	nodes, _ := c.Get("nodes")
+	hasRegex := nodeRegex != nil && fmt.Sprint(nodeRegex) != ""
+	hasNodes := false
+	if list, ok := nodes.([]interface{}); ok {
+		hasNodes = len(list) > 0
+	}
+
+	if hasRegex == hasNodes {
+		return []error{fmt.Errorf("exactly one of node_regex and nodes has to be set")}
+	}
+	return nil
+}
+
+// desiredBgpPeerGroupPeers returns the node scoped peers of every node in
+// the datastore matched by node_regex or nodes, for every peer IP
+func desiredBgpPeerGroupPeers(d *schema.ResourceData, config config) (map[string]api.BGPPeer, error) {
+	asNumber, err := numorstring.ASNumberFromString(d.Get("as_number").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := matchNodes(d, config, "node_regex", "nodes")
+	if err != nil {
+		return nil, err
+	}
+
+	peers := make(map[string]api.BGPPeer)
+	for _, node := range nodes {
+		for _, ip := range d.Get("peer_ips").([]interface{}) {
+			metadata := api.BGPPeerMetadata{
+				Scope:  scope.Node,
+				Node:   node.Metadata.Name,
+				PeerIP: caliconet.IP{net.ParseIP(ip.(string))},
+			}
+			peers[bgpPeerGroupKey(metadata)] = api.BGPPeer{
+				Metadata: metadata,
+				Spec: api.BGPPeerSpec{
+					ASNumber: asNumber,
+				},
+			}
+		}
+	}
+
+	return peers, nil
+}
+
+// matchNodes returns the nodes in the datastore whose name matches the
+// regex in regexField or is listed in namesField, all of them when neither
+// is set
+func matchNodes(d *schema.ResourceData, config config, regexField, namesField string) ([]api.Node, error) {
+	nodeRegex := d.Get(regexField).(string)
+	nodeNames := d.Get(namesField).([]interface{})
+
+	matches := func(name string) bool {
+		if len(nodeNames) == 0 {
+			return true
+		}
+		for _, n := range nodeNames {
+			if n.(string) == name {
+				return true
+			}
+		}
+		return false
+	}
+	if nodeRegex != "" {
+		re, err := regexp.Compile(nodeRegex)
+		if err != nil {
+			return nil, err
+		}
+		matches = re.MatchString
+	}
+
+	list, err := config.Client.Nodes().List(api.NodeMetadata{})
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: %v", err)
+	}
+
+	nodes := []api.Node{}
+	for _, node := range list.Items {
+		if matches(node.Metadata.Name) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil
+}
+
+// existingBgpPeers returns the node scoped peers in the datastore
+func existingBgpPeers(config config) (map[string]api.BGPPeer, error) {
+	list, err := config.Client.BGPPeers().List(api.BGPPeerMetadata{
+		Scope: scope.Node,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: %v", err)
+	}
+
+	peers := make(map[string]api.BGPPeer, len(list.Items))
+	for _, peer := range list.Items {
+		peers[bgpPeerGroupKey(peer.Metadata)] = peer
+	}
+
+	return peers, nil
+}
+
+// bgpPeersDrift returns the peers in state that still exist, and describes
+// how they differ from the desired peers
+func bgpPeersDrift(d *schema.ResourceData, desired, existing map[string]api.BGPPeer) ([]string, string) {
+	// peers removed out of band are no longer managed
+	managed := []string{}
+	isManaged := make(map[string]bool)
+	for _, v := range d.Get("peers").([]interface{}) {
+		if _, ok := existing[v.(string)]; ok {
+			managed = append(managed, v.(string))
+			isManaged[v.(string)] = true
+		}
+	}
+
+	add, update, remove := 0, 0, 0
+	for key, peer := range desired {
+		if e, ok := existing[key]; !ok || !isManaged[key] {
+			add++
+		} else if e.Spec.ASNumber != peer.Spec.ASNumber {
+			update++
+		}
+	}
+	for _, key := range managed {
+		if _, ok := desired[key]; !ok {
+			remove++
+		}
+	}
+
+	if add+update+remove == 0 {
+		return managed, ""
+	}
+	return managed, fmt.Sprintf("%d peers to add, %d to update, %d to remove", add, update, remove)
+}
+
+// adoptBgpPeers checks the desired peers that exist but weren't written by
+// the resource in d, they're only taken over according to adopt_existing
+func adoptBgpPeers(d *schema.ResourceData, config config, managed []string, desired, existing map[string]api.BGPPeer) error {
+	isManaged := make(map[string]bool, len(managed))
+	for _, key := range managed {
+		isManaged[key] = true
+	}
+
+	for _, key := range sortedKeys(desired) {
+		e, ok := existing[key]
+		if !ok || isManaged[key] {
+			continue
+		}
+
+		peer := desired[key]
+		id := "BGP peer " + bgpPeerId(peer.Metadata)
+		if config.adoptMode(d) == adoptNever {
+			return fmt.Errorf("ERROR: %s already exists and isn't managed by %s, set adopt_existing to take it over", id, d.Id())
+		}
+		if _, err := config.adopt(d, id, e.Metadata, e.Spec, peer.Metadata, peer.Spec); err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// reconcileBgpPeers writes the desired peers that are missing or differ,
+// removes the managed ones that are no longer desired and records the
+// managed peers in state. Existing peers it didn't write are refused unless
+// they're adopted.
+func reconcileBgpPeers(d *schema.ResourceData, config config, desired, existing map[string]api.BGPPeer) error {
+	managed := []string{}
+	for _, v := range d.Get("peers").([]interface{}) {
+		managed = append(managed, v.(string))
+	}
+
+	if err := adoptBgpPeers(d, config, managed, desired, existing); err != nil {
+		return err
+	}
+
+	peers, err := reconcileKeys(managed, sortedKeys(desired),
+		func(key string) error {
+			peer := desired[key]
+			if e, ok := existing[key]; ok && e.Spec.ASNumber == peer.Spec.ASNumber {
+				return nil
+			}
+			config.cache.invalidate(bgpPeerCacheKey(peer.Metadata))
+			_, err := config.Client.BGPPeers().Apply(&peer)
+			return err
+		},
+		func(key string) error {
+			return deleteBgpPeer(config, bgpPeerGroupMetadata(key))
+		})
+	d.Set("peers", peers)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	return nil
+}
+
+// deleteBgpPeer removes a peer that may already be gone
+func deleteBgpPeer(config config, metadata api.BGPPeerMetadata) error {
+	config.cache.invalidate(bgpPeerCacheKey(metadata))
+	if err := config.Client.BGPPeers().Delete(metadata); err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(peers map[string]api.BGPPeer) []string {
+	keys := make([]string, 0, len(peers))
+	for key := range peers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func resourceCalicoBgpPeerGroupCreate(d *schema.ResourceData, meta interface{}) error {
+	d.SetId(d.Get("name").(string))
+	return resourceCalicoBgpPeerGroupUpdate(d, meta)
+}
+
+func resourceCalicoBgpPeerGroupRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	desired, err := desiredBgpPeerGroupPeers(d, config)
+	if err != nil {
+		return err
+	}
+	existing, err := existingBgpPeers(config)
+	if err != nil {
+		return err
+	}
+
+	managed, drift := bgpPeersDrift(d, desired, existing)
+	d.Set("peers", managed)
+	d.Set("drift", drift)
+
+	return nil
+}
+
+func resourceCalicoBgpPeerGroupUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	desired, err := desiredBgpPeerGroupPeers(d, config)
+	if err != nil {
+		return err
+	}
+	existing, err := existingBgpPeers(config)
+	if err != nil {
+		return err
+	}
+
+	if err := reconcileBgpPeers(d, config, desired, existing); err != nil {
+		return err
+	}
+
+	return resourceCalicoBgpPeerGroupRead(d, meta)
+}
+
+func resourceCalicoBgpPeerGroupDelete(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	for _, v := range d.Get("peers").([]interface{}) {
+		if err := deleteBgpPeer(config, bgpPeerGroupMetadata(v.(string))); err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -3,12 +3,15 @@ package calico
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
 	"github.com/projectcalico/libcalico-go/lib/api"
 	"github.com/projectcalico/libcalico-go/lib/errors"
 	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
 )
 
 func resourceCalicoHostendpoint() *schema.Resource {
@@ -33,13 +36,38 @@ func resourceCalicoHostendpoint() *schema.Resource {
 			},
 			"interface": &schema.Schema{
 				Type:     schema.TypeString,
-				Required: true,
+				Optional: true,
 			},
 			"expected_ips": &schema.Schema{
-				Type:     schema.TypeList,
-				Required: true,
+				Type:     schema.TypeSet,
+				Optional: true,
 				Elem: &schema.Schema{
-					Type: schema.TypeString,
+					Type:         schema.TypeString,
+					ValidateFunc: validateIP,
+				},
+				Set: hashIP,
+			},
+			"ports": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": &schema.Schema{
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validatePortName,
+						},
+						"protocol": &schema.Schema{
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validatePortProtocol,
+						},
+						"port": &schema.Schema{
+							Type:         schema.TypeInt,
+							Required:     true,
+							ValidateFunc: validatePortNumber,
+						},
+					},
 				},
 			},
 			"profiles": &schema.Schema{
@@ -49,10 +77,68 @@ func resourceCalicoHostendpoint() *schema.Resource {
 					Type: schema.TypeString,
 				},
 			},
+			"update_mode": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateUpdateMode(true),
+			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateAdoptExisting(true),
+			},
+			"revision": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"overwrite_on_conflict": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
 		},
 	}
 }
 
+// checkHostEndpointConfig requires an interface or expected IPs, Calico
+// finds the interface by either, and unique port names at plan time
+func checkHostEndpointConfig(c *terraform.ResourceConfig) []error {
+	es := []error{}
+
+	if !c.IsComputed("interface") && !c.IsComputed("expected_ips") {
+		interfaceName, _ := c.Get("interface")
+		expectedIPs, _ := c.Get("expected_ips")
+		hasInterface := interfaceName != nil && fmt.Sprint(interfaceName) != ""
+		hasExpectedIPs := false
+		if list, ok := expectedIPs.([]interface{}); ok {
+			hasExpectedIPs = len(list) > 0
+		}
+		if !hasInterface && !hasExpectedIPs {
+			es = append(es, fmt.Errorf("a host endpoint needs an interface or expected_ips"))
+		}
+	}
+
+	if ports, ok := c.Get("ports"); ok && !c.IsComputed("ports") {
+		names := make(map[string]bool)
+		list, _ := ports.([]interface{})
+		for _, port := range list {
+			m, ok := port.(map[string]interface{})
+			if !ok || m["name"] == nil {
+				continue
+			}
+			name := fmt.Sprint(m["name"])
+			if names[name] {
+				es = append(es, fmt.Errorf("ports: name %q is used more than once", name))
+			}
+			names[name] = true
+		}
+	}
+
+	return es
+}
+
 func dToHostEndpointMetadata(d *schema.ResourceData) api.HostEndpointMetadata {
 	metadata := api.HostEndpointMetadata{
 		Name: d.Get("name").(string),
@@ -76,23 +162,43 @@ func dToHostEndpointSpec(d *schema.ResourceData) (api.HostEndpointSpec, error) {
 	spec := api.HostEndpointSpec{}
 	spec.InterfaceName = d.Get("interface").(string)
 
-	if v, ok := d.GetOk("expected_ips.#"); ok {
-		ips := make([]caliconet.IP, v.(int))
+	if v, ok := d.GetOk("expected_ips"); ok {
+		ipList := v.(*schema.Set).List()
+		ips := make([]caliconet.IP, len(ipList))
 
-		for i := range ips {
-			ip := d.Get("expected_ips." + strconv.Itoa(i)).(string)
-			validIP := net.ParseIP(ip)
+		for i, ip := range ipList {
+			validIP := net.ParseIP(ip.(string))
 			if validIP == nil {
 				return spec, fmt.Errorf("expected_ips: %v is not IP", ip)
 			}
 			ips[i] = caliconet.IP{validIP}
 		}
+		sort.Sort(ipsByString(ips))
 
 		if len(ips) != 0 {
 			spec.ExpectedIPs = ips
 		}
 	}
 
+	// Calico finds the interface by its name or by the expected IPs
+	if spec.InterfaceName == "" && len(spec.ExpectedIPs) == 0 {
+		return spec, fmt.Errorf("ERROR: host endpoint %s needs an interface or expected_ips", d.Get("name").(string))
+	}
+
+	if v, ok := d.GetOk("ports.#"); ok {
+		ports := make([]api.EndpointPort, v.(int))
+
+		for i := range ports {
+			prefix := "ports." + strconv.Itoa(i)
+			ports[i] = api.EndpointPort{
+				Name:     d.Get(prefix + ".name").(string),
+				Protocol: numorstring.ProtocolFromString(d.Get(prefix + ".protocol").(string)),
+				Port:     uint16(d.Get(prefix + ".port").(int)),
+			}
+		}
+		spec.Ports = ports
+	}
+
 	if v, ok := d.GetOk("profiles.#"); ok {
 		profiles := make([]string, v.(int))
 
@@ -108,6 +214,26 @@ func dToHostEndpointSpec(d *schema.ResourceData) (api.HostEndpointSpec, error) {
 	return spec, nil
 }
 
+// merge the configured attributes of spec into an existing HostEndpointSpec
+func mergeHostEndpointSpec(existing api.HostEndpointSpec, spec api.HostEndpointSpec, d *schema.ResourceData) api.HostEndpointSpec {
+	merged := existing
+
+	if _, ok := d.GetOk("interface"); ok {
+		merged.InterfaceName = spec.InterfaceName
+	}
+	if _, ok := d.GetOk("expected_ips"); ok {
+		merged.ExpectedIPs = spec.ExpectedIPs
+	}
+	if _, ok := d.GetOk("profiles"); ok {
+		merged.Profiles = spec.Profiles
+	}
+	if _, ok := d.GetOk("ports"); ok {
+		merged.Ports = spec.Ports
+	}
+
+	return merged
+}
+
 func resourceCalicoHostendpointCreate(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
 	calicoClient := config.Client
@@ -119,23 +245,59 @@ func resourceCalicoHostendpointCreate(d *schema.ResourceData, meta interface{})
 	}
 
 	hostEndpoints := calicoClient.HostEndpoints()
+	config.cache.invalidate(hostEndpointCacheKey(metadata))
 	if _, err = hostEndpoints.Create(&api.HostEndpoint{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		if _, ok := err.(errors.ErrorResourceAlreadyExists); !ok || config.adoptMode(d) == adoptNever {
+			return err
+		}
+		if err := adoptHostEndpoint(d, config, metadata, spec); err != nil {
+			return err
+		}
 	}
 
 	d.SetId(metadata.Name)
 	return resourceCalicoHostendpointRead(d, meta)
 }
 
+// take over an existing HostEndpoint instead of creating it
+func adoptHostEndpoint(d *schema.ResourceData, config config, metadata api.HostEndpointMetadata, spec api.HostEndpointSpec) error {
+	calicoClient, revisions := config.conditionalClient(d)
+	hostEndpoints := calicoClient.HostEndpoints()
+
+	existing, err := hostEndpoints.Get(metadata)
+	if err != nil {
+		return err
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+	if config.mergeOnUpdate(d) {
+		metadata.Labels = mergeLabels(existing.Metadata.Labels, d, "labels")
+		spec = mergeHostEndpointSpec(existing.Spec, spec, d)
+	}
+
+	write, err := config.adopt(d, "host endpoint "+metadata.Node+"/"+metadata.Name, existing.Metadata, existing.Spec, metadata, spec)
+	if err != nil || !write {
+		return err
+	}
+
+	if _, err = hostEndpoints.Apply(&api.HostEndpoint{
+		Metadata: metadata,
+		Spec:     spec,
+	}); err != nil {
+		return revisions.conflict(err)
+	}
+
+	return nil
+}
+
 func resourceCalicoHostendpointRead(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
 
-	hostEndpoints := calicoClient.HostEndpoints()
-	hostEndpoint, err := hostEndpoints.Get(api.HostEndpointMetadata{
+	hostEndpoint, revision, err := config.getHostEndpoint(api.HostEndpointMetadata{
 		Name: d.Get("name").(string),
 		Node: d.Get("node").(string),
 	})
@@ -146,69 +308,105 @@ func resourceCalicoHostendpointRead(d *schema.ResourceData, meta interface{}) er
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
 	}
 
+	merge := config.mergeOnUpdate(d)
+
 	d.SetId(hostEndpoint.Metadata.Name)
 	d.Set("name", hostEndpoint.Metadata.Name)
 	d.Set("node", hostEndpoint.Metadata.Node)
-	d.Set("labels", hostEndpoint.Metadata.Labels)
+	d.Set("labels", managedLabels(d, merge, "labels", hostEndpoint.Metadata.Labels))
 
-	d.Set("profiles", hostEndpoint.Spec.Profiles)
+	setManaged(d, merge, "profiles", hostEndpoint.Spec.Profiles)
 
 	ipList := make([]string, len(hostEndpoint.Spec.ExpectedIPs))
 	for i, ip := range hostEndpoint.Spec.ExpectedIPs {
 		ipList[i] = ip.String()
 	}
-	d.Set("expected_ips", ipList)
-	d.Set("interface", hostEndpoint.Spec.InterfaceName)
+	setManaged(d, merge, "expected_ips", ipList)
+	setManaged(d, merge, "interface", hostEndpoint.Spec.InterfaceName)
+
+	portList := make([]interface{}, len(hostEndpoint.Spec.Ports))
+	for i, port := range hostEndpoint.Spec.Ports {
+		portList[i] = map[string]interface{}{
+			"name":     port.Name,
+			"protocol": port.Protocol.String(),
+			"port":     int(port.Port),
+		}
+	}
+	setManaged(d, merge, "ports", portList)
+	d.Set("revision", revision)
 
 	return nil
 }
 
 func resourceCalicoHostendpointUpdate(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	hostEndpoints := calicoClient.HostEndpoints()
 
 	// Handle non-existant resource
 	metadata := dToHostEndpointMetadata(d)
-	if _, err := hostEndpoints.Get(metadata); err != nil {
+	existing, err := hostEndpoints.Get(metadata)
+	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
 	}
 
-	// Simply recreate the complete resource
+	// Simply recreate the complete resource, or merge it into the existing one
 	spec, err := dToHostEndpointSpec(d)
 	if err != nil {
 		return err
 	}
+	if config.mergeOnUpdate(d) {
+		metadata.Labels = mergeLabels(existing.Metadata.Labels, d, "labels")
+		spec = mergeHostEndpointSpec(existing.Spec, spec, d)
+	}
 
+	config.cache.invalidate(hostEndpointCacheKey(metadata))
 	if _, err = hostEndpoints.Apply(&api.HostEndpoint{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		return revisions.conflict(err)
 	}
 
-	return nil
+	return resourceCalicoHostendpointRead(d, meta)
 }
 
 func resourceCalicoHostendpointDelete(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	hostEndpoints := calicoClient.HostEndpoints()
-	err := hostEndpoints.Delete(api.HostEndpointMetadata{
+	metadata := api.HostEndpointMetadata{
 		Name: d.Get("name").(string),
 		Node: d.Get("node").(string),
-	})
+	}
+	if _, err := hostEndpoints.Get(metadata); err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+
+	config.cache.invalidate(hostEndpointCacheKey(metadata))
+	err := hostEndpoints.Delete(metadata)
 
 	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
-			return fmt.Errorf("ERROR: %v", err)
+			return fmt.Errorf("ERROR: %v", revisions.conflict(err))
 		}
 	}
 
@@ -0,0 +1,265 @@
+package calico
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+)
+
+// number of attempts of a read-modify-write cycle that lost a race
+const labelWriteAttempts = 3
+
+// labelOwners registers which calico_hostendpoint_labels resource manages
+// each label key of a host endpoint, so two resources claiming the same key
+// fail instead of overwriting each other on every run
+var labelOwners = struct {
+	sync.Mutex
+	owners map[string]string
+}{owners: make(map[string]string)}
+
+func labelOwnerKey(metadata api.HostEndpointMetadata, key string) string {
+	return metadata.Node + "/" + metadata.Name + "/" + key
+}
+
+// claimLabels registers owner for the label keys of the host endpoint
+func claimLabels(metadata api.HostEndpointMetadata, keys []string, owner string) error {
+	labelOwners.Lock()
+	defer labelOwners.Unlock()
+
+	for _, key := range keys {
+		if o, ok := labelOwners.owners[labelOwnerKey(metadata, key)]; ok && o != owner {
+			return fmt.Errorf("ERROR: label %s of host endpoint %s/%s is also managed by %s", key, metadata.Node, metadata.Name, o)
+		}
+	}
+	for _, key := range keys {
+		labelOwners.owners[labelOwnerKey(metadata, key)] = owner
+	}
+
+	return nil
+}
+
+func releaseLabels(metadata api.HostEndpointMetadata, keys []string, owner string) {
+	labelOwners.Lock()
+	defer labelOwners.Unlock()
+
+	for _, key := range keys {
+		if labelOwners.owners[labelOwnerKey(metadata, key)] == owner {
+			delete(labelOwners.owners, labelOwnerKey(metadata, key))
+		}
+	}
+}
+
+func resourceCalicoHostendpointLabels() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCalicoHostendpointLabelsCreate,
+		Read:   resourceCalicoHostendpointLabelsRead,
+		Update: resourceCalicoHostendpointLabelsUpdate,
+		Delete: resourceCalicoHostendpointLabelsDelete,
+
+		Schema: map[string]*schema.Schema{
+			"node": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"labels": &schema.Schema{
+				Type:     schema.TypeMap,
+				Required: true,
+			},
+			"applied": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+			"overwrite_on_conflict": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+		},
+	}
+}
+
+func dToHostEndpointLabelsMetadata(d *schema.ResourceData) api.HostEndpointMetadata {
+	return api.HostEndpointMetadata{
+		Name: d.Get("name").(string),
+		Node: d.Get("node").(string),
+	}
+}
+
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// writeHostEndpointLabels moves the label keys of the endpoint from previous
+// to desired in a compare-and-swap read-modify-write cycle, leaving all other
+// labels and the spec alone. A key is in conflict when the endpoint carries
+// a value for it that this resource didn't write.
+func writeHostEndpointLabels(d *schema.ResourceData, config config, previous, desired map[string]interface{}) error {
+	metadata := dToHostEndpointLabelsMetadata(d)
+	applied := d.Get("applied").(map[string]interface{})
+
+	for attempt := 1; ; attempt++ {
+		calicoClient, revisions := newRevisionClient(config.Client)
+		hostEndpoints := calicoClient.HostEndpoints()
+
+		hostEndpoint, err := hostEndpoints.Get(metadata)
+		if err != nil {
+			return err
+		}
+		revisions.hold()
+
+		labels := make(map[string]string, len(hostEndpoint.Metadata.Labels)+len(desired))
+		for k, v := range hostEndpoint.Metadata.Labels {
+			labels[k] = v
+		}
+
+		conflicts := []string{}
+		for _, k := range mapKeys(desired) {
+			current, exists := labels[k]
+			written, ours := applied[k]
+			if exists && current != desired[k].(string) && (!ours || current != written.(string)) {
+				conflicts = append(conflicts, fmt.Sprintf("%s=%s", k, current))
+			}
+			labels[k] = desired[k].(string)
+		}
+		for _, k := range mapKeys(previous) {
+			if _, ok := desired[k]; ok {
+				continue
+			}
+			// keys that changed hands since are left to their new owner
+			if written, ours := applied[k]; ours && labels[k] == written.(string) {
+				delete(labels, k)
+			}
+		}
+
+		if len(conflicts) > 0 && !d.Get("overwrite_on_conflict").(bool) {
+			return fmt.Errorf("ERROR: host endpoint %s/%s already has labels %s set by others, "+
+				"set overwrite_on_conflict to take them over", metadata.Node, metadata.Name, strings.Join(conflicts, ", "))
+		}
+
+		if len(labels) == 0 {
+			labels = nil
+		}
+		hostEndpoint.Metadata.Labels = labels
+
+		config.cache.invalidate(hostEndpointCacheKey(metadata))
+		_, err = hostEndpoints.Apply(hostEndpoint)
+		if _, ok := err.(errors.ErrorResourceUpdateConflict); ok && attempt < labelWriteAttempts {
+			log.Printf("[DEBUG] host endpoint %s/%s changed while its labels were written, retrying", metadata.Node, metadata.Name)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("ERROR: %v", revisions.conflict(err))
+		}
+		break
+	}
+
+	d.Set("applied", desired)
+	return nil
+}
+
+func resourceCalicoHostendpointLabelsCreate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	id := resource.UniqueId()
+	metadata := dToHostEndpointLabelsMetadata(d)
+	if err := claimLabels(metadata, mapKeys(d.Get("labels").(map[string]interface{})), id); err != nil {
+		return err
+	}
+
+	if err := writeHostEndpointLabels(d, config, map[string]interface{}{}, d.Get("labels").(map[string]interface{})); err != nil {
+		releaseLabels(metadata, mapKeys(d.Get("labels").(map[string]interface{})), id)
+		return err
+	}
+
+	d.SetId(id)
+	return resourceCalicoHostendpointLabelsRead(d, meta)
+}
+
+// Read reports the current values of the managed keys only
+func resourceCalicoHostendpointLabelsRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	metadata := dToHostEndpointLabelsMetadata(d)
+	hostEndpoint, _, err := config.getHostEndpoint(metadata)
+	if err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	keys := mapKeys(d.Get("labels").(map[string]interface{}))
+	if err := claimLabels(metadata, keys, d.Id()); err != nil {
+		return err
+	}
+
+	labels := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		if v, ok := hostEndpoint.Metadata.Labels[k]; ok {
+			labels[k] = v
+		}
+	}
+	d.Set("labels", labels)
+
+	return nil
+}
+
+func resourceCalicoHostendpointLabelsUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	metadata := dToHostEndpointLabelsMetadata(d)
+	o, n := d.GetChange("labels")
+	if err := claimLabels(metadata, mapKeys(n.(map[string]interface{})), d.Id()); err != nil {
+		return err
+	}
+
+	if err := writeHostEndpointLabels(d, config, o.(map[string]interface{}), n.(map[string]interface{})); err != nil {
+		return err
+	}
+
+	removed := []string{}
+	for k := range o.(map[string]interface{}) {
+		if _, ok := n.(map[string]interface{})[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+	releaseLabels(metadata, removed, d.Id())
+
+	return resourceCalicoHostendpointLabelsRead(d, meta)
+}
+
+func resourceCalicoHostendpointLabelsDelete(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	metadata := dToHostEndpointLabelsMetadata(d)
+	labels := d.Get("labels").(map[string]interface{})
+
+	if err := writeHostEndpointLabels(d, config, labels, map[string]interface{}{}); err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
+			return err
+		}
+	}
+	releaseLabels(metadata, mapKeys(labels), d.Id())
+
+	return nil
+}
@@ -0,0 +1,407 @@
+package calico
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+)
+
+// number of nodes named in the drift of bulk resources
+const driftNodes = 10
+
+func resourceCalicoHostendpoints() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCalicoHostendpointsCreate,
+		Read:   resourceCalicoHostendpointsRead,
+		Update: resourceCalicoHostendpointsUpdate,
+		Delete: resourceCalicoHostendpointsDelete,
+
+		Schema: map[string]*schema.Schema{
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"node_regex": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateRegexp,
+			},
+			"nodes": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"labels": &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+			},
+			"interface": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"expected_ips_from": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "ipv4",
+				ValidateFunc: validateExpectedIPsFrom,
+			},
+			"profiles": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"update_mode": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateUpdateMode(true),
+			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateAdoptExisting(true),
+			},
+			"endpoints": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"drift": driftSchema(),
+		},
+	}
+}
+
+func validateExpectedIPsFrom(v interface{}, k string) (ws []string, es []error) {
+	switch v.(string) {
+	case "ipv4", "ipv6", "both", "none":
+	default:
+		es = append(es, fmt.Errorf("%s must be %q, %q, %q or %q, got %q", k, "ipv4", "ipv6", "both", "none", v))
+	}
+	return
+}
+
+// desiredHostEndpoints returns the host endpoint of every matching node,
+// keyed by node name
+func desiredHostEndpoints(d *schema.ResourceData, config config) (map[string]api.HostEndpoint, error) {
+	interfaceName := d.Get("interface").(string)
+	expectedIPsFrom := d.Get("expected_ips_from").(string)
+	if interfaceName == "" && expectedIPsFrom == "none" {
+		return nil, fmt.Errorf("ERROR: host endpoints need an interface or expected IPs")
+	}
+
+	nodes, err := matchNodes(d, config, "node_regex", "nodes")
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string(nil)
+	if v := d.Get("labels").(map[string]interface{}); len(v) > 0 {
+		labels = make(map[string]string, len(v))
+		for k, value := range v {
+			labels[k] = value.(string)
+		}
+	}
+	profiles := []string(nil)
+	for _, v := range d.Get("profiles").([]interface{}) {
+		profiles = append(profiles, v.(string))
+	}
+
+	hostEndpoints := make(map[string]api.HostEndpoint)
+	for _, node := range nodes {
+		expectedIPs := []caliconet.IP(nil)
+		if node.Spec.BGP != nil {
+			if (expectedIPsFrom == "ipv4" || expectedIPsFrom == "both") && node.Spec.BGP.IPv4Address != nil {
+				expectedIPs = append(expectedIPs, caliconet.IP{node.Spec.BGP.IPv4Address.IP})
+			}
+			if (expectedIPsFrom == "ipv6" || expectedIPsFrom == "both") && node.Spec.BGP.IPv6Address != nil {
+				expectedIPs = append(expectedIPs, caliconet.IP{node.Spec.BGP.IPv6Address.IP})
+			}
+		}
+		// a node without the addresses to match the endpoint on is skipped
+		// until calico/node registers them
+		if interfaceName == "" && len(expectedIPs) == 0 {
+			continue
+		}
+
+		hostEndpoints[node.Metadata.Name] = api.HostEndpoint{
+			Metadata: api.HostEndpointMetadata{
+				Name:   d.Get("name").(string),
+				Node:   node.Metadata.Name,
+				Labels: labels,
+			},
+			Spec: api.HostEndpointSpec{
+				InterfaceName: interfaceName,
+				ExpectedIPs:   expectedIPs,
+				Profiles:      profiles,
+			},
+		}
+	}
+
+	return hostEndpoints, nil
+}
+
+// existingHostEndpoints returns the host endpoints named name, keyed by node
+func existingHostEndpoints(config config, name string) (map[string]api.HostEndpoint, error) {
+	list, err := config.Client.HostEndpoints().List(api.HostEndpointMetadata{
+		Name: name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ERROR: %v", err)
+	}
+
+	hostEndpoints := make(map[string]api.HostEndpoint, len(list.Items))
+	for _, hostEndpoint := range list.Items {
+		hostEndpoints[hostEndpoint.Metadata.Node] = hostEndpoint
+	}
+
+	return hostEndpoints, nil
+}
+
+// writtenHostEndpoint returns existing with the attributes of desired the
+// resource manages, and labels, the existing ones with the configured keys
+// set, see mergeLabels. Ports and the labels of others are kept. In merge
+// mode an interface, expected IPs or profiles left empty in desired are
+// left alone too.
+func writtenHostEndpoint(existing, desired api.HostEndpoint, labels map[string]string, merge bool) api.HostEndpoint {
+	written := existing
+	written.Metadata.Labels = labels
+
+	if !merge || desired.Spec.InterfaceName != "" {
+		written.Spec.InterfaceName = desired.Spec.InterfaceName
+	}
+	if !merge || len(desired.Spec.ExpectedIPs) > 0 {
+		written.Spec.ExpectedIPs = desired.Spec.ExpectedIPs
+	}
+	if !merge || len(desired.Spec.Profiles) > 0 {
+		written.Spec.Profiles = desired.Spec.Profiles
+	}
+
+	return written
+}
+
+// hostEndpointWrites returns the host endpoints to write for desired, based
+// on the existing ones, see writtenHostEndpoint
+func hostEndpointWrites(d *schema.ResourceData, config config, desired, existing map[string]api.HostEndpoint) map[string]api.HostEndpoint {
+	merge := config.mergeOnUpdate(d)
+
+	writes := make(map[string]api.HostEndpoint, len(desired))
+	for node, hostEndpoint := range desired {
+		e, ok := existing[node]
+		if !ok {
+			writes[node] = hostEndpoint
+			continue
+		}
+		writes[node] = writtenHostEndpoint(e, hostEndpoint, mergeLabels(e.Metadata.Labels, d, "labels"), merge)
+	}
+
+	return writes
+}
+
+// hostEndpointChanges names the attributes that differ between two host
+// endpoints
+func hostEndpointChanges(existing, desired api.HostEndpoint) []string {
+	changes := []string{}
+
+	if len(existing.Metadata.Labels)+len(desired.Metadata.Labels) > 0 &&
+		!reflect.DeepEqual(existing.Metadata.Labels, desired.Metadata.Labels) {
+		changes = append(changes, "labels")
+	}
+	if existing.Spec.InterfaceName != desired.Spec.InterfaceName {
+		changes = append(changes, "interface")
+	}
+	if fmt.Sprint(existing.Spec.ExpectedIPs) != fmt.Sprint(desired.Spec.ExpectedIPs) {
+		changes = append(changes, "expected_ips")
+	}
+	if strings.Join(existing.Spec.Profiles, ",") != strings.Join(desired.Spec.Profiles, ",") {
+		changes = append(changes, "profiles")
+	}
+
+	return changes
+}
+
+// describeNodes lists the first nodes of a drift category
+func describeNodes(action string, nodes []string) string {
+	sort.Strings(nodes)
+	if len(nodes) > driftNodes {
+		return fmt.Sprintf("%s %s and %d more", action, strings.Join(nodes[:driftNodes], ", "), len(nodes)-driftNodes)
+	}
+	return fmt.Sprintf("%s %s", action, strings.Join(nodes, ", "))
+}
+
+func managedHostEndpoints(d *schema.ResourceData) []string {
+	managed := []string{}
+	for _, v := range d.Get("endpoints").([]interface{}) {
+		managed = append(managed, v.(string))
+	}
+	return managed
+}
+
+// adoptHostEndpoints checks the desired host endpoints that exist but weren't
+// written by the resource in d, they're only taken over according to
+// adopt_existing
+func adoptHostEndpoints(d *schema.ResourceData, config config, nodes []string, desired, existing map[string]api.HostEndpoint) error {
+	isManaged := make(map[string]bool)
+	for _, node := range managedHostEndpoints(d) {
+		isManaged[node] = true
+	}
+
+	for _, node := range nodes {
+		e, ok := existing[node]
+		if !ok || isManaged[node] {
+			continue
+		}
+
+		hostEndpoint := desired[node]
+		id := fmt.Sprintf("host endpoint %s on node %s", hostEndpoint.Metadata.Name, node)
+		if config.adoptMode(d) == adoptNever {
+			return fmt.Errorf("ERROR: %s already exists and isn't managed by %s, set adopt_existing to take it over", id, d.Id())
+		}
+		if _, err := config.adopt(d, id, e.Metadata, e.Spec, hostEndpoint.Metadata, hostEndpoint.Spec); err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func resourceCalicoHostendpointsCreate(d *schema.ResourceData, meta interface{}) error {
+	d.SetId(d.Get("name").(string))
+	return resourceCalicoHostendpointsUpdate(d, meta)
+}
+
+func resourceCalicoHostendpointsRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	desired, err := desiredHostEndpoints(d, config)
+	if err != nil {
+		return err
+	}
+	existing, err := existingHostEndpoints(config, d.Get("name").(string))
+	if err != nil {
+		return err
+	}
+
+	// endpoints removed out of band are no longer managed
+	managed := []string{}
+	isManaged := make(map[string]bool)
+	for _, node := range managedHostEndpoints(d) {
+		if _, ok := existing[node]; ok {
+			managed = append(managed, node)
+			isManaged[node] = true
+		}
+	}
+
+	create, update, remove := []string{}, []string{}, []string{}
+	for node, hostEndpoint := range hostEndpointWrites(d, config, desired, existing) {
+		e, ok := existing[node]
+		if !ok || !isManaged[node] {
+			create = append(create, node)
+		} else if changes := hostEndpointChanges(e, hostEndpoint); len(changes) > 0 {
+			update = append(update, node+" ("+strings.Join(changes, ", ")+")")
+		}
+	}
+	for _, node := range managed {
+		if _, ok := desired[node]; !ok {
+			remove = append(remove, node)
+		}
+	}
+
+	drift := []string{}
+	if len(create) > 0 {
+		drift = append(drift, describeNodes("create", create))
+	}
+	if len(update) > 0 {
+		drift = append(drift, describeNodes("update", update))
+	}
+	if len(remove) > 0 {
+		drift = append(drift, describeNodes("remove", remove))
+	}
+
+	d.Set("endpoints", managed)
+	d.Set("drift", joinDrift(drift))
+
+	return nil
+}
+
+func resourceCalicoHostendpointsUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+	hostEndpoints := config.Client.HostEndpoints()
+
+	desired, err := desiredHostEndpoints(d, config)
+	if err != nil {
+		return err
+	}
+	existing, err := existingHostEndpoints(config, d.Get("name").(string))
+	if err != nil {
+		return err
+	}
+
+	nodes := make([]string, 0, len(desired))
+	for node := range desired {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	writes := hostEndpointWrites(d, config, desired, existing)
+	if err := adoptHostEndpoints(d, config, nodes, writes, existing); err != nil {
+		return err
+	}
+
+	endpoints, err := reconcileKeys(managedHostEndpoints(d), nodes,
+		func(node string) error {
+			hostEndpoint := writes[node]
+			if e, ok := existing[node]; ok && len(hostEndpointChanges(e, hostEndpoint)) == 0 {
+				return nil
+			}
+			config.cache.invalidate(hostEndpointCacheKey(hostEndpoint.Metadata))
+			_, err := hostEndpoints.Apply(&hostEndpoint)
+			return err
+		},
+		func(node string) error {
+			return deleteHostEndpoint(config, api.HostEndpointMetadata{
+				Name: d.Get("name").(string),
+				Node: node,
+			})
+		})
+	d.Set("endpoints", endpoints)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	return resourceCalicoHostendpointsRead(d, meta)
+}
+
+func resourceCalicoHostendpointsDelete(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	for _, node := range managedHostEndpoints(d) {
+		err := deleteHostEndpoint(config, api.HostEndpointMetadata{
+			Name: d.Get("name").(string),
+			Node: node,
+		})
+		if err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteHostEndpoint removes a host endpoint that may already be gone
+func deleteHostEndpoint(config config, metadata api.HostEndpointMetadata) error {
+	config.cache.invalidate(hostEndpointCacheKey(metadata))
+	if err := config.Client.HostEndpoints().Delete(metadata); err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package calico
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/projectcalico/libcalico-go/lib/api"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+func testExistingHostEndpoint() api.HostEndpoint {
+	return api.HostEndpoint{
+		Metadata: api.HostEndpointMetadata{
+			Name:   "host",
+			Node:   "worker-1",
+			Labels: map[string]string{"role": "worker", "pci": "true"},
+		},
+		Spec: api.HostEndpointSpec{
+			InterfaceName: "eth0",
+			ExpectedIPs:   []caliconet.IP{caliconet.IP{net.ParseIP("10.0.0.1")}},
+			Profiles:      []string{"other"},
+			Ports: []api.EndpointPort{
+				{Name: "http", Protocol: numorstring.ProtocolFromString("tcp"), Port: 80},
+			},
+		},
+	}
+}
+
+func TestWrittenHostEndpoint(t *testing.T) {
+	existing := testExistingHostEndpoint()
+	desired := api.HostEndpoint{
+		Metadata: api.HostEndpointMetadata{
+			Name:   "host",
+			Node:   "worker-1",
+			Labels: map[string]string{"role": "worker"},
+		},
+		Spec: api.HostEndpointSpec{
+			ExpectedIPs: []caliconet.IP{caliconet.IP{net.ParseIP("10.0.0.1")}},
+			Profiles:    []string{"endpointprofile"},
+		},
+	}
+	labels := map[string]string{"role": "worker", "pci": "true"}
+
+	// ports and the labels set by others are kept in both modes, an interface
+	// left empty is only written in replace mode
+	cases := []struct {
+		merge   bool
+		changes []string
+	}{
+		{false, []string{"interface", "profiles"}},
+		{true, []string{"profiles"}},
+	}
+	for _, c := range cases {
+		merge := c.merge
+		written := writtenHostEndpoint(existing, desired, labels, merge)
+		if !reflect.DeepEqual(written.Spec.Ports, existing.Spec.Ports) {
+			t.Errorf("merge %v: expected ports %v, got %v", merge, existing.Spec.Ports, written.Spec.Ports)
+		}
+		if !reflect.DeepEqual(written.Metadata.Labels, labels) {
+			t.Errorf("merge %v: expected labels %v, got %v", merge, labels, written.Metadata.Labels)
+		}
+		if changes := hostEndpointChanges(existing, written); !reflect.DeepEqual(changes, c.changes) {
+			t.Errorf("merge %v: expected changes %v, got %v", merge, c.changes, changes)
+		}
+	}
+	if existing.Spec.Profiles[0] != "other" {
+		t.Errorf("writtenHostEndpoint changed the existing endpoint")
+	}
+}
+
+func TestHostEndpointChanges_foreignLabels(t *testing.T) {
+	existing := testExistingHostEndpoint()
+	desired := existing
+	desired.Metadata.Labels = map[string]string{"role": "worker"}
+	desired.Spec.Ports = nil
+
+	// a label added by calico_hostendpoint_labels is no change once the
+	// desired endpoint is based on the existing one
+	written := writtenHostEndpoint(existing, desired, existing.Metadata.Labels, false)
+	if changes := hostEndpointChanges(existing, written); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changes)
+	}
+}
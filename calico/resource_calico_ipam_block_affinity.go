@@ -0,0 +1,160 @@
+package calico
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+)
+
+// IPAM block sizes, fixed by Calico
+const (
+	ipv4BlockPrefixLength = 26
+	ipv6BlockPrefixLength = 122
+)
+
+func resourceCalicoIpamBlockAffinity() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCalicoIpamBlockAffinityCreate,
+		Read:   resourceCalicoIpamBlockAffinityRead,
+		Delete: resourceCalicoIpamBlockAffinityDelete,
+
+		Schema: map[string]*schema.Schema{
+			"cidr": &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateCIDR,
+			},
+			"node": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"confirmed": &schema.Schema{
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"allocated": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// dToBlockCIDR reads the block CIDR and makes sure it's exactly one block
+// inside an existing IP pool
+func dToBlockCIDR(d *schema.ResourceData, config config) (caliconet.IPNet, error) {
+	cidr, err := dToCIDR(d, "cidr")
+	if err != nil {
+		return cidr, err
+	}
+
+	blockPrefixLength := ipv4BlockPrefixLength
+	if ipVersion(cidr.IP) == 6 {
+		blockPrefixLength = ipv6BlockPrefixLength
+	}
+	if ones, _ := cidr.Mask.Size(); ones != blockPrefixLength {
+		return cidr, fmt.Errorf("ERROR: %s isn't an IPAM block, IPv%d blocks are /%d", cidr.String(), ipVersion(cidr.IP), blockPrefixLength)
+	}
+
+	pools, err := config.Client.IPPools().List(api.IPPoolMetadata{})
+	if err != nil {
+		return cidr, fmt.Errorf("ERROR: %v", err)
+	}
+	for _, pool := range pools.Items {
+		if pool.Metadata.CIDR.Contains(cidr.IP) {
+			return cidr, nil
+		}
+	}
+
+	return cidr, fmt.Errorf("ERROR: block %s isn't in any IP pool", cidr.String())
+}
+
+func resourceCalicoIpamBlockAffinityCreate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+	calicoClient := config.Client
+
+	cidr, err := dToBlockCIDR(d, config)
+	if err != nil {
+		return err
+	}
+	node := d.Get("node").(string)
+	if _, _, err := config.getNode(api.NodeMetadata{Name: node}); err != nil {
+		return fmt.Errorf("ERROR: node %s: %v", node, err)
+	}
+
+	_, failed, err := calicoClient.IPAM().ClaimAffinity(cidr, &node)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("ERROR: block %s is claimed by another node", cidr.String())
+	}
+
+	d.SetId(node + "/" + cidr.String())
+	return resourceCalicoIpamBlockAffinityRead(d, meta)
+}
+
+func resourceCalicoIpamBlockAffinityRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+	calicoClient := config.Client
+
+	cidr, err := dToCIDR(d, "cidr")
+	if err != nil {
+		return err
+	}
+	node := d.Get("node").(string)
+
+	// the affinity is recorded per node, and confirmed on the block itself
+	if _, err := calicoClient.Backend.Get(model.BlockAffinityKey{CIDR: cidr, Host: node}); err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	confirmed := false
+	allocated := 0
+
+	kvp, err := calicoClient.Backend.Get(model.BlockKey{CIDR: cidr})
+	if err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	} else {
+		block := kvp.Value.(*model.AllocationBlock)
+		confirmed = block.HostAffinity != nil && *block.HostAffinity == node
+		allocated = blockAllocations(block, map[string]bool{}).total()
+	}
+
+	d.Set("cidr", cidr.String())
+	d.Set("confirmed", confirmed)
+	d.Set("allocated", allocated)
+
+	return nil
+}
+
+func resourceCalicoIpamBlockAffinityDelete(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+	calicoClient := config.Client
+
+	cidr, err := dToCIDR(d, "cidr")
+	if err != nil {
+		return err
+	}
+	node := d.Get("node").(string)
+
+	if err := calicoClient.IPAM().ReleaseAffinity(cidr, &node); err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	return nil
+}
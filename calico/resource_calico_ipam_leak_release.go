@@ -0,0 +1,141 @@
+package calico
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func resourceCalicoIpamLeakRelease() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCalicoIpamLeakReleaseCreate,
+		Read:   resourceCalicoIpamLeakReleaseRead,
+		Update: resourceCalicoIpamLeakReleaseUpdate,
+		Delete: resourceCalicoIpamLeakReleaseDelete,
+
+		Schema: map[string]*schema.Schema{
+			"cidr": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validateCIDR,
+			},
+			"min_age": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "1h",
+				ValidateFunc: validateDuration,
+			},
+			"dry_run": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"first_seen": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+			"releasable": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"released": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"drift": driftSchema(),
+		},
+	}
+}
+
+func resourceCalicoIpamLeakReleaseCreate(d *schema.ResourceData, meta interface{}) error {
+	cidr, err := dToOptionalCIDR(d, "cidr")
+	if err != nil {
+		return err
+	}
+
+	d.SetId(ipamLeaksId(cidr))
+	return resourceCalicoIpamLeakReleaseUpdate(d, meta)
+}
+
+// Read tracks since when every leaked handle has been seen, IPAM keeps no
+// timestamps, and reports the handles older than min_age as drift
+func resourceCalicoIpamLeakReleaseRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	cidr, err := dToOptionalCIDR(d, "cidr")
+	if err != nil {
+		return err
+	}
+	leaks, err := findIPAMLeaks(config.Client, cidr)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	now := time.Now().UTC()
+	minAge, _ := time.ParseDuration(d.Get("min_age").(string))
+	known := d.Get("first_seen").(map[string]interface{})
+
+	firstSeen := make(map[string]interface{}, len(leaks))
+	releasable := []string{}
+	for _, leak := range leaks {
+		seen := now
+		if v, ok := known[leak.handle]; ok {
+			if t, err := time.Parse(time.RFC3339, v.(string)); err == nil {
+				seen = t
+			}
+		}
+		firstSeen[leak.handle] = seen.Format(time.RFC3339)
+
+		if now.Sub(seen) >= minAge {
+			releasable = append(releasable, leak.handle)
+		}
+	}
+	sort.Strings(releasable)
+
+	d.Set("first_seen", firstSeen)
+	d.Set("releasable", releasable)
+
+	drift := ""
+	if len(releasable) > 0 && !d.Get("dry_run").(bool) {
+		drift = fmt.Sprintf("%d leaked handles to release", len(releasable))
+	}
+	d.Set("drift", drift)
+
+	return nil
+}
+
+func resourceCalicoIpamLeakReleaseUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	// refresh the leaks first, handles may have been reused since the plan
+	if err := resourceCalicoIpamLeakReleaseRead(d, meta); err != nil {
+		return err
+	}
+
+	released := []string{}
+	if !d.Get("dry_run").(bool) {
+		for _, v := range d.Get("releasable").([]interface{}) {
+			handle := v.(string)
+
+			log.Printf("[INFO] releasing leaked IPAM handle %s", handle)
+			if err := config.Client.IPAM().ReleaseByHandle(handle); err != nil {
+				return fmt.Errorf("ERROR: releasing handle %s: %v", handle, err)
+			}
+			released = append(released, handle)
+		}
+	}
+	d.Set("released", released)
+
+	return resourceCalicoIpamLeakReleaseRead(d, meta)
+}
+
+func resourceCalicoIpamLeakReleaseDelete(d *schema.ResourceData, meta interface{}) error {
+	d.SetId("")
+	return nil
+}
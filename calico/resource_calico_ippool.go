@@ -2,10 +2,17 @@ package calico
 
 import (
 	"fmt"
+	"log"
+	"net"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
 	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/client"
 	"github.com/projectcalico/libcalico-go/lib/errors"
+	"github.com/projectcalico/libcalico-go/lib/ipip"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
 )
 
 func resourceCalicoIpPool() *schema.Resource {
@@ -17,8 +24,9 @@ func resourceCalicoIpPool() *schema.Resource {
 
 		Schema: map[string]*schema.Schema{
 			"cidr": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateCIDR,
 			},
 			"spec": &schema.Schema{
 				Type:     schema.TypeList,
@@ -35,6 +43,11 @@ func resourceCalicoIpPool() *schema.Resource {
 										Type:     schema.TypeBool,
 										Optional: true,
 									},
+									"mode": &schema.Schema{
+										Type:         schema.TypeString,
+										Optional:     true,
+										ValidateFunc: validateIPIPMode,
+									},
 								},
 							},
 						},
@@ -49,10 +62,93 @@ func resourceCalicoIpPool() *schema.Resource {
 					},
 				},
 			},
+			"update_mode": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateUpdateMode(true),
+			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateAdoptExisting(true),
+			},
+			"revision": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"overwrite_on_conflict": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"drain": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"replacement_strategy": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      replaceRecreate,
+				ValidateFunc: validateReplacementStrategy,
+			},
+			"drain_timeout": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "10m",
+				ValidateFunc: validateDuration,
+			},
 		},
 	}
 }
 
+// Strategies to move a pool to a new CIDR
+const (
+	replaceRecreate = "recreate"
+	replaceDrain    = "drain"
+)
+
+func validateReplacementStrategy(v interface{}, k string) (ws []string, es []error) {
+	switch v.(string) {
+	case replaceRecreate, replaceDrain:
+	default:
+		es = append(es, fmt.Errorf("%s must be %q or %q, got %q", k, replaceRecreate, replaceDrain, v))
+	}
+	return
+}
+
+func validateIPIPMode(v interface{}, k string) (ws []string, es []error) {
+	switch ipip.Mode(v.(string)) {
+	case ipip.Undefined, ipip.Always, ipip.CrossSubnet:
+	default:
+		es = append(es, fmt.Errorf("%s must be %q or %q, got %q", k, ipip.Always, ipip.CrossSubnet, v))
+	}
+	return
+}
+
+// checkIpPoolConfig refuses IPIP on IPv6 pools at plan time
+func checkIpPoolConfig(c *terraform.ResourceConfig) []error {
+	if c.IsComputed("cidr") || c.IsComputed("spec.0.ipip.0.enabled") {
+		return nil
+	}
+	cidr, ok := c.Get("cidr")
+	if !ok {
+		return nil
+	}
+	enabled, ok := c.Get("spec.0.ipip.0.enabled")
+	if !ok || fmt.Sprint(enabled) != "true" {
+		return nil
+	}
+
+	ip, _, err := net.ParseCIDR(fmt.Sprint(cidr))
+	if err == nil && ipVersion(ip) == 6 {
+		return []error{fmt.Errorf("IPIP can't be enabled on IPv6 pool %s", cidr)}
+	}
+	return nil
+}
+
 func dToIpPoolMetadata(d *schema.ResourceData) (api.IPPoolMetadata, error) {
 	metadata := api.IPPoolMetadata{}
 
@@ -68,11 +164,24 @@ func dToIpPoolMetadata(d *schema.ResourceData) (api.IPPoolMetadata, error) {
 func dToIpPoolSpec(d *schema.ResourceData) (api.IPPoolSpec, error) {
 	spec := api.IPPoolSpec{}
 
-	ipipEnabled := d.Get("spec.0.ipip.0.enabled").(bool)
-	ipip := api.IPIPConfiguration{
-		Enabled: ipipEnabled,
+	// IPIP is only written when it's configured, so pools without it don't
+	// come back from the datastore with settings that aren't in config
+	if _, ok := d.GetOk("spec.0.ipip.#"); ok {
+		ipipConfig := api.IPIPConfiguration{
+			Enabled: d.Get("spec.0.ipip.0.enabled").(bool),
+			Mode:    ipip.Mode(d.Get("spec.0.ipip.0.mode").(string)),
+		}
+
+		cidr, err := dToCIDR(d, "cidr")
+		if err != nil {
+			return spec, err
+		}
+		if ipipConfig.Enabled && ipVersion(cidr.IP) == 6 {
+			return spec, fmt.Errorf("ERROR: IPIP can't be enabled on IPv6 pool %s", cidr.String())
+		}
+
+		spec.IPIP = &ipipConfig
 	}
-	spec.IPIP = &ipip
 
 	natOutgoing := d.Get("spec.0.nat-outgoing").(bool)
 	spec.NATOutgoing = natOutgoing
@@ -83,14 +192,31 @@ func dToIpPoolSpec(d *schema.ResourceData) (api.IPPoolSpec, error) {
 	return spec, nil
 }
 
+// merge the configured attributes of spec into an existing IPPoolSpec
+func mergeIPPoolSpec(existing api.IPPoolSpec, spec api.IPPoolSpec, d *schema.ResourceData) api.IPPoolSpec {
+	merged := existing
+
+	if _, ok := d.GetOk("spec.0.ipip.#"); ok {
+		merged.IPIP = spec.IPIP
+	}
+	if _, ok := d.GetOk("spec.0.nat-outgoing"); ok {
+		merged.NATOutgoing = spec.NATOutgoing
+	}
+	if _, ok := d.GetOk("spec.0.disabled"); ok {
+		merged.Disabled = spec.Disabled
+	}
+
+	return merged
+}
+
 // set Schema Fields based on existing IPPool Specs
-func setSchemaFieldsForIPPoolSpec(ippool *api.IPPool, d *schema.ResourceData) {
+func setSchemaFieldsForIPPoolSpec(ippool *api.IPPool, d *schema.ResourceData, merge bool) {
 	specArray := make([]interface{}, 1)
 
 	specMap := make(map[string]interface{})
 
-	specMap["nat-outgoing"] = ippool.Spec.NATOutgoing
-	specMap["disabled"] = ippool.Spec.Disabled
+	specMap["nat-outgoing"] = managedValue(d, merge, "spec.0.nat-outgoing", ippool.Spec.NATOutgoing)
+	specMap["disabled"] = managedValue(d, merge, "spec.0.disabled", ippool.Spec.Disabled)
 
 	ipipMapArray := make([]interface{}, 1)
 
@@ -98,7 +224,8 @@ func setSchemaFieldsForIPPoolSpec(ippool *api.IPPool, d *schema.ResourceData) {
 
 	pIPIP := ippool.Spec.IPIP
 	if pIPIP != nil {
-		ipipMap["enabled"] = pIPIP.Enabled
+		ipipMap["enabled"] = managedValue(d, merge, "spec.0.ipip.0.enabled", pIPIP.Enabled)
+		ipipMap["mode"] = managedValue(d, merge, "spec.0.ipip.0.mode", string(pIPIP.Mode))
 		ipipMapArray[0] = ipipMap
 
 		specMap["ipip"] = ipipMapArray
@@ -122,28 +249,69 @@ func resourceCalicoIpPoolCreate(d *schema.ResourceData, meta interface{}) error
 		return err
 	}
 
+	ipPoolWrites.Lock()
+	defer ipPoolWrites.Unlock()
+	if err := config.checkIPPoolOverlap(metadata.CIDR, ""); err != nil {
+		return err
+	}
+
 	ipPools := calicoClient.IPPools()
+	config.cache.invalidate(ipPoolCacheKey(metadata))
 	if _, err = ipPools.Create(&api.IPPool{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		if _, ok := err.(errors.ErrorResourceAlreadyExists); !ok || config.adoptMode(d) == adoptNever {
+			return err
+		}
+		if err := adoptIPPool(d, config, metadata, spec); err != nil {
+			return err
+		}
 	}
 
 	d.SetId(metadata.CIDR.String())
 	return resourceCalicoIpPoolRead(d, meta)
 }
 
+// take over an existing IPPool instead of creating it
+func adoptIPPool(d *schema.ResourceData, config config, metadata api.IPPoolMetadata, spec api.IPPoolSpec) error {
+	calicoClient, revisions := config.conditionalClient(d)
+	ipPools := calicoClient.IPPools()
+
+	existing, err := ipPools.Get(metadata)
+	if err != nil {
+		return err
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+	if config.mergeOnUpdate(d) {
+		spec = mergeIPPoolSpec(existing.Spec, spec, d)
+	}
+
+	write, err := config.adopt(d, "IP pool "+metadata.CIDR.String(), existing.Metadata, existing.Spec, metadata, spec)
+	if err != nil || !write {
+		return err
+	}
+
+	if _, err = ipPools.Apply(&api.IPPool{
+		Metadata: metadata,
+		Spec:     spec,
+	}); err != nil {
+		return revisions.conflict(err)
+	}
+
+	return nil
+}
+
 func resourceCalicoIpPoolRead(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
 
-	ipPools := calicoClient.IPPools()
 	cidr, err := dToCIDR(d, "cidr")
 	if err != nil {
 		return err
 	}
-	ipPool, err := ipPools.Get(api.IPPoolMetadata{
+	ipPool, revision, err := config.getIPPool(api.IPPoolMetadata{
 		CIDR: cidr,
 	})
 
@@ -153,67 +321,226 @@ func resourceCalicoIpPoolRead(d *schema.ResourceData, meta interface{}) error {
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
 	}
 
 	d.SetId(ipPool.Metadata.CIDR.String())
 	d.Set("cidr", ipPool.Metadata.CIDR.String())
-	setSchemaFieldsForIPPoolSpec(ipPool, d)
+	setSchemaFieldsForIPPoolSpec(ipPool, d, config.mergeOnUpdate(d))
+	d.Set("revision", revision)
 
 	return nil
 }
 
 func resourceCalicoIpPoolUpdate(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	ipPools := calicoClient.IPPools()
 
+	if d.HasChange("cidr") {
+		if err := replaceIPPool(d, config); err != nil {
+			return err
+		}
+		return resourceCalicoIpPoolRead(d, meta)
+	}
+
 	// Handle non-existant resource
 	metadata, err := dToIpPoolMetadata(d)
 	if err != nil {
 		return err
 	}
-	if _, err := ipPools.Get(metadata); err != nil {
+	existing, err := ipPools.Get(metadata)
+	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
 	}
 
-	// Simply recreate the complete resource
+	// Simply recreate the complete resource, or merge it into the existing one
 	spec, err := dToIpPoolSpec(d)
 	if err != nil {
 		return err
 	}
+	if config.mergeOnUpdate(d) {
+		spec = mergeIPPoolSpec(existing.Spec, spec, d)
+	}
 
+	// the cidr is unchanged, it was checked for overlaps when the pool was
+	// created or replaced
+	config.cache.invalidate(ipPoolCacheKey(metadata))
 	if _, err = ipPools.Apply(&api.IPPool{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		return revisions.conflict(err)
 	}
 
-	return nil
+	return resourceCalicoIpPoolRead(d, meta)
 }
 
 func resourceCalicoIpPoolDelete(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	ipPools := calicoClient.IPPools()
 	cidr, err := dToCIDR(d, "cidr")
 	if err != nil {
 		return err
 	}
-	err = ipPools.Delete(api.IPPoolMetadata{
+	metadata := api.IPPoolMetadata{
 		CIDR: cidr,
-	})
+	}
+	existing, err := ipPools.Get(metadata)
+	if err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+
+	return removeIPPool(d, config, calicoClient, revisions, existing)
+}
+
+// removeIPPool deletes pool once IPAM has no addresses allocated from it,
+// draining it first when drain is set
+func removeIPPool(d *schema.ResourceData, config config, calicoClient *client.Client, revisions *revisionBackend, pool *api.IPPool) error {
+	cidr := pool.Metadata.CIDR
+
+	// don't pull the pool from under live workloads
+	count, handles, err := ipamAllocations(calicoClient, cidr)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if count.workloads > 0 {
+		if !d.Get("drain").(bool) {
+			return fmt.Errorf("ERROR: IP pool %s still has %d allocations, e.g. handles %v; set drain to disable it and wait for them to be released",
+				cidr.String(), count.workloads, handles)
+		}
+
+		timeout, _ := time.ParseDuration(d.Get("drain_timeout").(string))
+		if err := drainIPPool(config, calicoClient, pool, timeout); err != nil {
+			return fmt.Errorf("ERROR: %v", revisions.conflict(err))
+		}
+	}
+
+	config.cache.invalidate(ipPoolCacheKey(pool.Metadata))
+	err = calicoClient.IPPools().Delete(pool.Metadata)
+
+	if err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
+			return fmt.Errorf("ERROR: %v", revisions.conflict(err))
+		}
+	}
+
+	return nil
+}
+
+// createReplacementIPPool creates the new pool of a replacement, once it
+// passed the overlap check
+func createReplacementIPPool(config config, ipPools client.IPPoolInterface, pool *api.IPPool, replacing string) error {
+	ipPoolWrites.Lock()
+	defer ipPoolWrites.Unlock()
+
+	if err := config.checkIPPoolOverlap(pool.Metadata.CIDR, replacing); err != nil {
+		return err
+	}
+	config.cache.invalidate(ipPoolCacheKey(pool.Metadata))
+	if _, err := ipPools.Create(pool); err != nil {
+		if _, ok := err.(errors.ErrorResourceAlreadyExists); ok {
+			return err
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	return nil
+}
 
+// replaceIPPool moves the resource to its new CIDR. The recreate strategy
+// removes the old pool before creating the new one, the drain strategy
+// creates the new pool first and removes the old one once it's drained.
+// State keeps the old CIDR until the replacement completes, so a failed or
+// timed out replacement resumes on the next apply.
+func replaceIPPool(d *schema.ResourceData, config config) error {
+	calicoClient, revisions := config.conditionalClient(d)
+	ipPools := calicoClient.IPPools()
+
+	o, _ := d.GetChange("cidr")
+	_, oldCIDR, err := caliconet.ParseCIDR(o.(string))
+	if err != nil {
+		return fmt.Errorf("ERROR: couldn't parse CIDR: %v", err)
+	}
+	old, err := ipPools.Get(api.IPPoolMetadata{
+		CIDR: *oldCIDR,
+	})
 	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
 			return fmt.Errorf("ERROR: %v", err)
 		}
+		old = nil
+	} else if err := revisions.check(d); err != nil {
+		return err
 	}
 
+	metadata, err := dToIpPoolMetadata(d)
+	if err != nil {
+		return err
+	}
+	spec, err := dToIpPoolSpec(d)
+	if err != nil {
+		return err
+	}
+	pool := &api.IPPool{
+		Metadata: metadata,
+		Spec:     spec,
+	}
+
+	d.Partial(true)
+
+	switch d.Get("replacement_strategy").(string) {
+	case replaceDrain:
+		if err := createReplacementIPPool(config, ipPools, pool, ""); err != nil {
+			if _, ok := err.(errors.ErrorResourceAlreadyExists); !ok {
+				return err
+			}
+			log.Printf("[INFO] IP pool %s already exists, resuming its replacement of %s", metadata.CIDR.String(), oldCIDR.String())
+		}
+
+		if old != nil {
+			timeout, _ := time.ParseDuration(d.Get("drain_timeout").(string))
+			if err := drainIPPool(config, calicoClient, old, timeout); err != nil {
+				return fmt.Errorf("ERROR: %v", revisions.conflict(err))
+			}
+			if err := removeIPPool(d, config, calicoClient, revisions, old); err != nil {
+				return err
+			}
+		}
+	default:
+		// check before the old pool is gone, and again when it is
+		if err := config.checkIPPoolOverlap(metadata.CIDR, oldCIDR.String()); err != nil {
+			return err
+		}
+		if old != nil {
+			if err := removeIPPool(d, config, calicoClient, revisions, old); err != nil {
+				return err
+			}
+		}
+
+		if err := createReplacementIPPool(config, ipPools, pool, oldCIDR.String()); err != nil {
+			return err
+		}
+	}
+
+	d.Partial(false)
+	d.SetId(metadata.CIDR.String())
+
 	return nil
 }
@@ -2,10 +2,11 @@ package calico
 
 import (
 	"fmt"
-	"net"
 
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
 	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/client"
 	"github.com/projectcalico/libcalico-go/lib/errors"
 	caliconet "github.com/projectcalico/libcalico-go/lib/net"
 	"github.com/projectcalico/libcalico-go/lib/numorstring"
@@ -18,6 +19,9 @@ func resourceCalicoNode() *schema.Resource {
 		Update: resourceCalicoNodeUpdate,
 		Delete: resourceCalicoNodeDelete,
 
+		SchemaVersion: 1,
+		MigrateState:  resourceCalicoNodeMigrateState,
+
 		Schema: map[string]*schema.Schema{
 			"name": &schema.Schema{
 				Type:     schema.TypeString,
@@ -35,16 +39,21 @@ func resourceCalicoNode() *schema.Resource {
 							Elem: &schema.Resource{
 								Schema: map[string]*schema.Schema{
 									"asNumber": &schema.Schema{
-										Type:     schema.TypeString,
-										Optional: true,
+										Type:         schema.TypeString,
+										Optional:     true,
+										ValidateFunc: validateASNumber,
 									},
 									"ipv4Address": &schema.Schema{
-										Type:     schema.TypeString,
-										Optional: true,
+										Type:         schema.TypeString,
+										Optional:     true,
+										ValidateFunc: validateAddressCIDR(4),
+										StateFunc:    normalizeAddressCIDR,
 									},
 									"ipv6Address": &schema.Schema{
-										Type:     schema.TypeString,
-										Optional: true,
+										Type:         schema.TypeString,
+										Optional:     true,
+										ValidateFunc: validateAddressCIDR(6),
+										StateFunc:    normalizeAddressCIDR,
 									},
 								},
 							},
@@ -52,10 +61,60 @@ func resourceCalicoNode() *schema.Resource {
 					},
 				},
 			},
+			"bgp_only": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				ForceNew: true,
+			},
+			"detected_addresses": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+			},
+			"force_delete": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"update_mode": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateUpdateMode(true),
+			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateAdoptExisting(true),
+			},
+			"revision": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"overwrite_on_conflict": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
 		},
 	}
 }
 
+// resourceCalicoNodeMigrateState moves the bare BGP addresses of version 0
+// to the CIDR notation they're read back in
+func resourceCalicoNodeMigrateState(v int, is *terraform.InstanceState, meta interface{}) (*terraform.InstanceState, error) {
+	if v == 0 && is != nil {
+		for _, k := range []string{"spec.0.bgp.0.ipv4Address", "spec.0.bgp.0.ipv6Address"} {
+			if address, ok := is.Attributes[k]; ok && address != "" {
+				is.Attributes[k] = normalizeAddressCIDR(address)
+			}
+		}
+	}
+
+	return is, nil
+}
+
 func dToNodeMetadata(d *schema.ResourceData) api.NodeMetadata {
 	metadata := api.NodeMetadata{}
 
@@ -66,30 +125,166 @@ func dToNodeMetadata(d *schema.ResourceData) api.NodeMetadata {
 
 func dToNodeSpec(d *schema.ResourceData) (api.NodeSpec, error) {
 	spec := api.NodeSpec{}
-	bgpSpec := api.NodeBGPSpec{}
 
-	asNumber := d.Get("spec.0.bgp.0.asNumber").(string)
+	// without a bgp block the node isn't configured for BGP
+	if _, ok := d.GetOk("spec.0.bgp.#"); !ok {
+		return spec, nil
+	}
+	bgpSpec := api.NodeBGPSpec{}
 
-	num, err := numorstring.ASNumberFromString(asNumber)
-	if err != nil {
-		return spec, err
+	// an empty asNumber inherits the global AS number
+	if asNumber := d.Get("spec.0.bgp.0.asNumber").(string); asNumber != "" {
+		num, err := numorstring.ASNumberFromString(asNumber)
+		if err != nil {
+			return spec, err
+		}
+		bgpSpec.ASNumber = &num
 	}
-	bgpSpec.ASNumber = &num
 
-	ip := d.Get("spec.0.bgp.0.ipv4Address").(string)
-	ipV4 := caliconet.IP{net.ParseIP(ip)}
-	bgpSpec.IPv4Address = &ipV4
+	if ip := d.Get("spec.0.bgp.0.ipv4Address").(string); ip != "" {
+		ipV4, err := parseAddressCIDR(ip, 4)
+		if err != nil {
+			return spec, fmt.Errorf("ipv4Address: %v", err)
+		}
+		bgpSpec.IPv4Address = ipV4
+	}
 
-	ip = d.Get("spec.0.bgp.0.ipv6Address").(string)
-	ipV6 := caliconet.IP{net.ParseIP(ip)}
-	bgpSpec.IPv6Address = &ipV6
+	if ip := d.Get("spec.0.bgp.0.ipv6Address").(string); ip != "" {
+		ipV6, err := parseAddressCIDR(ip, 6)
+		if err != nil {
+			return spec, fmt.Errorf("ipv6Address: %v", err)
+		}
+		bgpSpec.IPv6Address = ipV6
+	}
 	spec.BGP = &bgpSpec
 
 	return spec, nil
 }
 
+// merge the configured attributes of spec into an existing NodeSpec
+func mergeNodeSpec(existing api.NodeSpec, spec api.NodeSpec, d *schema.ResourceData) api.NodeSpec {
+	merged := existing
+
+	if spec.BGP != nil {
+		bgpSpec := api.NodeBGPSpec{}
+		if existing.BGP != nil {
+			bgpSpec = *existing.BGP
+		}
+
+		if _, ok := d.GetOk("spec.0.bgp.0.asNumber"); ok {
+			bgpSpec.ASNumber = spec.BGP.ASNumber
+		}
+		if _, ok := d.GetOk("spec.0.bgp.0.ipv4Address"); ok {
+			bgpSpec.IPv4Address = spec.BGP.IPv4Address
+		}
+		if _, ok := d.GetOk("spec.0.bgp.0.ipv6Address"); ok {
+			bgpSpec.IPv6Address = spec.BGP.IPv6Address
+		}
+		merged.BGP = &bgpSpec
+	}
+
+	return merged
+}
+
+// clear the BGP attributes Terraform manages from an existing NodeSpec. The
+// addresses go back to what calico/node detected before Terraform took over,
+// they are left alone when that wasn't recorded.
+func clearNodeSpec(existing api.NodeSpec, d *schema.ResourceData) api.NodeSpec {
+	cleared := existing
+	if existing.BGP == nil {
+		return cleared
+	}
+
+	bgpSpec := *existing.BGP
+	if _, ok := d.GetOk("spec.0.bgp.0.asNumber"); ok {
+		bgpSpec.ASNumber = nil
+	}
+	detected := d.Get("detected_addresses").(map[string]interface{})
+	if _, ok := d.GetOk("spec.0.bgp.0.ipv4Address"); ok {
+		if address, ok := detected["ipv4Address"]; ok {
+			bgpSpec.IPv4Address = detectedAddress(address.(string), 4)
+		}
+	}
+	if _, ok := d.GetOk("spec.0.bgp.0.ipv6Address"); ok {
+		if address, ok := detected["ipv6Address"]; ok {
+			bgpSpec.IPv6Address = detectedAddress(address.(string), 6)
+		}
+	}
+
+	if bgpSpec.ASNumber == nil && bgpSpec.IPv4Address == nil && bgpSpec.IPv6Address == nil {
+		cleared.BGP = nil
+	} else {
+		cleared.BGP = &bgpSpec
+	}
+
+	return cleared
+}
+
+// detectedAddresses records the BGP addresses of a node before Terraform
+// writes its own, an empty value for an address that wasn't set
+func detectedAddresses(spec api.NodeSpec) map[string]interface{} {
+	detected := map[string]interface{}{
+		"ipv4Address": "",
+		"ipv6Address": "",
+	}
+	if spec.BGP != nil && spec.BGP.IPv4Address != nil {
+		detected["ipv4Address"] = spec.BGP.IPv4Address.String()
+	}
+	if spec.BGP != nil && spec.BGP.IPv6Address != nil {
+		detected["ipv6Address"] = spec.BGP.IPv6Address.String()
+	}
+
+	return detected
+}
+
+func detectedAddress(address string, version int) *caliconet.IPNet {
+	if address == "" {
+		return nil
+	}
+	ipNet, err := parseAddressCIDR(address, version)
+	if err != nil {
+		return nil
+	}
+	return ipNet
+}
+
+// nodes managed with bgp_only are always merged into
+func mergeNodeOnUpdate(config config, d *schema.ResourceData) bool {
+	return d.Get("bgp_only").(bool) || config.mergeOnUpdate(d)
+}
+
+// check that no endpoints are left on a node, deleting a node also deletes
+// its workload endpoints and IPAM affinities
+func checkNodeUnused(calicoClient *client.Client, name string) error {
+	workloadEndpoints, err := calicoClient.WorkloadEndpoints().List(api.WorkloadEndpointMetadata{
+		Node: name,
+	})
+	if err != nil {
+		return err
+	}
+	hostEndpoints, err := calicoClient.HostEndpoints().List(api.HostEndpointMetadata{
+		Node: name,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(workloadEndpoints.Items) > 0 || len(hostEndpoints.Items) > 0 {
+		return fmt.Errorf("node %s still has %d workload endpoints and %d host endpoints, "+
+			"deleting it would also remove its workload endpoints and IPAM affinities; set force_delete to delete it anyway",
+			name, len(workloadEndpoints.Items), len(hostEndpoints.Items))
+	}
+
+	return nil
+}
+
 // set Schema Fields based on existing Node Specs
-func setSchemaFieldsForNodeSpec(node *api.Node, d *schema.ResourceData) {
+func setSchemaFieldsForNodeSpec(node *api.Node, d *schema.ResourceData, merge bool) {
+	if node.Spec.BGP == nil {
+		d.Set("spec", []interface{}{})
+		return
+	}
+
 	specArray := make([]interface{}, 1)
 
 	specMap := make(map[string]interface{})
@@ -98,9 +293,22 @@ func setSchemaFieldsForNodeSpec(node *api.Node, d *schema.ResourceData) {
 
 	bgpMap := make(map[string]interface{})
 
-	bgpMap["asNumber"] = node.Spec.BGP.ASNumber
-	bgpMap["ipv4Address"] = node.Spec.BGP.IPv4Address
-	bgpMap["ipv6Address"] = node.Spec.BGP.IPv6Address
+	asNumber := ""
+	if node.Spec.BGP.ASNumber != nil {
+		asNumber = node.Spec.BGP.ASNumber.String()
+	}
+	ipv4Address := ""
+	if node.Spec.BGP.IPv4Address != nil {
+		ipv4Address = node.Spec.BGP.IPv4Address.String()
+	}
+	ipv6Address := ""
+	if node.Spec.BGP.IPv6Address != nil {
+		ipv6Address = node.Spec.BGP.IPv6Address.String()
+	}
+
+	bgpMap["asNumber"] = managedValue(d, merge, "spec.0.bgp.0.asNumber", asNumber)
+	bgpMap["ipv4Address"] = managedValue(d, merge, "spec.0.bgp.0.ipv4Address", ipv4Address)
+	bgpMap["ipv6Address"] = managedValue(d, merge, "spec.0.bgp.0.ipv6Address", ipv6Address)
 	bgpMapArray[0] = bgpMap
 
 	specMap["bgp"] = bgpMapArray
@@ -121,24 +329,98 @@ func resourceCalicoNodeCreate(d *schema.ResourceData, meta interface{}) error {
 		return err
 	}
 
+	// nodes registered by calico/node only get their BGP attributes set
+	if d.Get("bgp_only").(bool) {
+		if err := mergeIntoNode(d, config, metadata, spec); err != nil {
+			return err
+		}
+
+		d.SetId(metadata.Name)
+		return resourceCalicoNodeRead(d, meta)
+	}
+
 	nodes := calicoClient.Nodes()
+	config.cache.invalidate(nodeCacheKey(metadata))
 	if _, err = nodes.Create(&api.Node{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		if _, ok := err.(errors.ErrorResourceAlreadyExists); !ok || config.adoptMode(d) == adoptNever {
+			return err
+		}
+		if err := adoptNode(d, config, metadata, spec); err != nil {
+			return err
+		}
 	}
 
 	d.SetId(metadata.Name)
 	return resourceCalicoNodeRead(d, meta)
 }
 
+// set the configured BGP attributes on an existing Node, leaving the rest of
+// it to calico/node
+func mergeIntoNode(d *schema.ResourceData, config config, metadata api.NodeMetadata, spec api.NodeSpec) error {
+	calicoClient, revisions := config.conditionalClient(d)
+	nodes := calicoClient.Nodes()
+
+	existing, err := nodes.Get(metadata)
+	if err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			return fmt.Errorf("node %s isn't registered, bgp_only only manages existing nodes", metadata.Name)
+		}
+		return err
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+	d.Set("detected_addresses", detectedAddresses(existing.Spec))
+
+	config.cache.invalidate(nodeCacheKey(metadata))
+	if _, err = nodes.Apply(&api.Node{
+		Metadata: metadata,
+		Spec:     mergeNodeSpec(existing.Spec, spec, d),
+	}); err != nil {
+		return revisions.conflict(err)
+	}
+
+	return nil
+}
+
+// take over an existing Node instead of creating it
+func adoptNode(d *schema.ResourceData, config config, metadata api.NodeMetadata, spec api.NodeSpec) error {
+	calicoClient, revisions := config.conditionalClient(d)
+	nodes := calicoClient.Nodes()
+
+	existing, err := nodes.Get(metadata)
+	if err != nil {
+		return err
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+	if mergeNodeOnUpdate(config, d) {
+		spec = mergeNodeSpec(existing.Spec, spec, d)
+	}
+
+	write, err := config.adopt(d, "node "+metadata.Name, existing.Metadata, existing.Spec, metadata, spec)
+	if err != nil || !write {
+		return err
+	}
+
+	if _, err = nodes.Apply(&api.Node{
+		Metadata: metadata,
+		Spec:     spec,
+	}); err != nil {
+		return revisions.conflict(err)
+	}
+
+	return nil
+}
+
 func resourceCalicoNodeRead(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
 
-	nodes := calicoClient.Nodes()
-	node, err := nodes.Get(api.NodeMetadata{
+	node, revision, err := config.getNode(api.NodeMetadata{
 		Name: d.Get("name").(string),
 	})
 
@@ -148,58 +430,101 @@ func resourceCalicoNodeRead(d *schema.ResourceData, meta interface{}) error {
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
 	}
 
 	d.SetId(d.Get("name").(string))
-	setSchemaFieldsForNodeSpec(node, d)
+	setSchemaFieldsForNodeSpec(node, d, mergeNodeOnUpdate(config, d))
+	d.Set("revision", revision)
 
 	return nil
 }
 
 func resourceCalicoNodeUpdate(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	nodes := calicoClient.Nodes()
 
 	// Handle non-existant resource
 	metadata := dToNodeMetadata(d)
 
-	if _, err := nodes.Get(metadata); err != nil {
+	existing, err := nodes.Get(metadata)
+	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
 	}
 
-	// Simply recreate the complete resource
+	// Simply recreate the complete resource, or merge it into the existing one
 	spec, err := dToNodeSpec(d)
 	if err != nil {
 		return err
 	}
+	if mergeNodeOnUpdate(config, d) {
+		spec = mergeNodeSpec(existing.Spec, spec, d)
+	}
 
+	config.cache.invalidate(nodeCacheKey(metadata))
 	if _, err = nodes.Apply(&api.Node{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		return revisions.conflict(err)
 	}
 
-	return nil
+	return resourceCalicoNodeRead(d, meta)
 }
 
 func resourceCalicoNodeDelete(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	nodes := calicoClient.Nodes()
-	err := nodes.Delete(api.NodeMetadata{
+	metadata := api.NodeMetadata{
 		Name: d.Get("name").(string),
-	})
+	}
+	existing, err := nodes.Get(metadata)
+	if err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+
+	// only clear what Terraform manages of nodes registered by calico/node
+	if d.Get("bgp_only").(bool) {
+		config.cache.invalidate(nodeCacheKey(metadata))
+		if _, err = nodes.Apply(&api.Node{
+			Metadata: metadata,
+			Spec:     clearNodeSpec(existing.Spec, d),
+		}); err != nil {
+			return fmt.Errorf("ERROR: %v", revisions.conflict(err))
+		}
+
+		return nil
+	}
+
+	if !d.Get("force_delete").(bool) {
+		if err := checkNodeUnused(calicoClient, metadata.Name); err != nil {
+			return err
+		}
+	}
+
+	config.cache.invalidate(nodeCacheKey(metadata))
+	err = nodes.Delete(metadata)
 
 	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
-			return fmt.Errorf("ERROR: %v", err)
+			return fmt.Errorf("ERROR: %v", revisions.conflict(err))
 		}
 	}
 
@@ -0,0 +1,136 @@
+package calico
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+)
+
+func resourceCalicoNodeReady() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCalicoNodeReadyCreate,
+		Read:   resourceCalicoNodeReadyRead,
+		Delete: resourceCalicoNodeReadyDelete,
+
+		Schema: map[string]*schema.Schema{
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"timeout": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      "10m",
+				ValidateFunc: validateDuration,
+			},
+			"ipv4_address": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"ipv6_address": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"as_number": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// nodeReady tells whether calico/node has registered the node with a BGP
+// address
+func nodeReady(node *api.Node) bool {
+	return node.Spec.BGP != nil && (node.Spec.BGP.IPv4Address != nil || node.Spec.BGP.IPv6Address != nil)
+}
+
+// Create waits until the node is registered
+func resourceCalicoNodeReadyCreate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	name := d.Get("name").(string)
+	timeout, _ := time.ParseDuration(d.Get("timeout").(string))
+
+	err := resource.Retry(timeout, func() *resource.RetryError {
+		node, err := config.Client.Nodes().Get(api.NodeMetadata{
+			Name: name,
+		})
+		if err != nil {
+			if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
+				return resource.NonRetryableError(err)
+			}
+			log.Printf("[INFO] waiting for node %s to register", name)
+			return resource.RetryableError(fmt.Errorf("node %s didn't register within %s", name, timeout))
+		}
+		if !nodeReady(node) {
+			log.Printf("[INFO] waiting for node %s to get a BGP address", name)
+			return resource.RetryableError(fmt.Errorf("node %s didn't get a BGP address within %s", name, timeout))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	// the node may have registered after the read cache took its snapshot
+	config.cache.invalidate(nodeCacheKey(api.NodeMetadata{Name: name}))
+
+	d.SetId(name)
+	return resourceCalicoNodeReadyRead(d, meta)
+}
+
+func resourceCalicoNodeReadyRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	node, _, err := config.getNode(api.NodeMetadata{
+		Name: d.Get("name").(string),
+	})
+
+	// a node that's gone, or lost its addresses, is waited for again
+	if err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if !nodeReady(node) {
+		d.SetId("")
+		return nil
+	}
+
+	ipv4Address, ipv6Address := "", ""
+	if node.Spec.BGP.IPv4Address != nil {
+		ipv4Address = node.Spec.BGP.IPv4Address.IP.String()
+	}
+	if node.Spec.BGP.IPv6Address != nil {
+		ipv6Address = node.Spec.BGP.IPv6Address.IP.String()
+	}
+
+	asNumber, err := config.Client.Config().GetGlobalASNumber()
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if node.Spec.BGP.ASNumber != nil {
+		asNumber = *node.Spec.BGP.ASNumber
+	}
+
+	d.Set("ipv4_address", ipv4Address)
+	d.Set("ipv6_address", ipv6Address)
+	d.Set("as_number", asNumber.String())
+
+	return nil
+}
+
+func resourceCalicoNodeReadyDelete(d *schema.ResourceData, meta interface{}) error {
+	d.SetId("")
+	return nil
+}
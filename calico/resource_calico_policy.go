@@ -28,8 +28,23 @@ func resourceCalicoPolicy() *schema.Resource {
 				Elem: &schema.Resource{
 					Schema: map[string]*schema.Schema{
 						"order": &schema.Schema{
-							Type:     schema.TypeFloat,
-							Optional: true,
+							Type:          schema.TypeString,
+							Optional:      true,
+							ValidateFunc:  validatePolicyOrder,
+							StateFunc:     normalizePolicyOrder,
+							ConflictsWith: []string{"spec.0.order_after", "spec.0.order_before"},
+						},
+						"order_after": &schema.Schema{
+							Type:          schema.TypeList,
+							Optional:      true,
+							Elem:          &schema.Schema{Type: schema.TypeString},
+							ConflictsWith: []string{"spec.0.order"},
+						},
+						"order_before": &schema.Schema{
+							Type:          schema.TypeList,
+							Optional:      true,
+							Elem:          &schema.Schema{Type: schema.TypeString},
+							ConflictsWith: []string{"spec.0.order"},
 						},
 						"selector": &schema.Schema{
 							Type:     schema.TypeString,
@@ -48,12 +63,39 @@ func resourceCalicoPolicy() *schema.Resource {
 					},
 				},
 			},
+			"update_mode": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateUpdateMode(true),
+			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateAdoptExisting(true),
+			},
+			"resolved_order": &schema.Schema{
+				Type:     schema.TypeFloat,
+				Computed: true,
+			},
+			"revision": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"overwrite_on_conflict": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"drift": driftSchema(),
 		},
 	}
 }
 
 func resourceCalicoPolicyCreate(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
+	registerRuleOwner(d, config, "policy")
 	calicoClient := config.Client
 
 	metadata := dToPolicyMetadata(d)
@@ -62,24 +104,67 @@ func resourceCalicoPolicyCreate(d *schema.ResourceData, meta interface{}) error
 		return err
 	}
 
+	policyPlacement.Lock()
+	defer policyPlacement.Unlock()
+	if err := placePolicy(d, config, &metadata, &spec); err != nil {
+		return err
+	}
+
 	policies := calicoClient.Policies()
+	config.cache.invalidate(policyCacheKey(metadata))
 	if _, err = policies.Create(&api.Policy{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		if _, ok := err.(errors.ErrorResourceAlreadyExists); !ok || config.adoptMode(d) == adoptNever {
+			return err
+		}
+		if err := adoptPolicy(d, config, metadata, spec); err != nil {
+			return err
+		}
 	}
 
 	d.SetId(metadata.Name)
 	return resourceCalicoPolicyRead(d, meta)
 }
 
+// take over an existing Policy instead of creating it
+func adoptPolicy(d *schema.ResourceData, config config, metadata api.PolicyMetadata, spec api.PolicySpec) error {
+	calicoClient, revisions := config.conditionalClient(d)
+	policies := calicoClient.Policies()
+
+	existing, err := policies.Get(metadata)
+	if err != nil {
+		return err
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+	if config.mergeOnUpdate(d) {
+		metadata.Annotations = policyOrderAnnotations(existing.Metadata.Annotations, annotatedPolicyOrder(metadata.Annotations))
+		spec = mergePolicySpec(existing.Spec, spec, d)
+	}
+
+	write, err := config.adopt(d, "policy "+metadata.Name, existing.Metadata, existing.Spec, metadata, spec)
+	if err != nil || !write {
+		return err
+	}
+
+	if _, err = policies.Apply(&api.Policy{
+		Metadata: metadata,
+		Spec:     spec,
+	}); err != nil {
+		return revisions.conflict(err)
+	}
+
+	return nil
+}
+
 func resourceCalicoPolicyRead(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	registerRuleOwner(d, config, "policy")
 
-	policies := calicoClient.Policies()
-	policy, err := policies.Get(api.PolicyMetadata{
+	policy, revision, err := config.getPolicy(api.PolicyMetadata{
 		Name: d.Get("name").(string),
 	})
 
@@ -95,52 +180,91 @@ func resourceCalicoPolicyRead(d *schema.ResourceData, meta interface{}) error {
 
 	d.Set("name", policy.Metadata.Name)
 
-	setSchemaFieldsForPolicySpec(policy, d)
+	setSchemaFieldsForPolicySpec(policy, d, config.mergeOnUpdate(d))
+	if policy.Spec.Order != nil {
+		d.Set("resolved_order", *policy.Spec.Order)
+	}
+	d.Set("revision", revision)
+
+	drift, err := policyOrderDrift(d, config, policy)
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	d.Set("drift", drift)
 
 	return nil
 }
 
 func resourceCalicoPolicyUpdate(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	registerRuleOwner(d, config, "policy")
+	calicoClient, revisions := config.conditionalClient(d)
 
 	policies := calicoClient.Policies()
 
 	metadata := dToPolicyMetadata(d)
-	if _, err := policies.Get(metadata); err != nil {
+	existing, err := policies.Get(metadata)
+	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
 	}
 
 	spec, err := dToPolicySpec(d)
 	if err != nil {
 		return err
 	}
+	if config.mergeOnUpdate(d) {
+		metadata.Annotations = existing.Metadata.Annotations
+		spec = mergePolicySpec(existing.Spec, spec, d)
+	}
 
+	policyPlacement.Lock()
+	defer policyPlacement.Unlock()
+	if err := placePolicy(d, config, &metadata, &spec); err != nil {
+		return err
+	}
+
+	config.cache.invalidate(policyCacheKey(metadata))
 	if _, err = policies.Apply(&api.Policy{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		return revisions.conflict(err)
 	}
 
-	return nil
+	return resourceCalicoPolicyRead(d, meta)
 }
 
 func resourceCalicoPolicyDelete(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	policies := calicoClient.Policies()
-	err := policies.Delete(api.PolicyMetadata{
+	metadata := api.PolicyMetadata{
 		Name: d.Get("name").(string),
-	})
+	}
+	if _, err := policies.Get(metadata); err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+
+	config.cache.invalidate(policyCacheKey(metadata))
+	err := policies.Delete(metadata)
 
 	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
-			return fmt.Errorf("ERROR: %v", err)
+			return fmt.Errorf("ERROR: %v", revisions.conflict(err))
 		}
 	}
 
@@ -148,36 +272,49 @@ func resourceCalicoPolicyDelete(d *schema.ResourceData, meta interface{}) error
 }
 
 // set Schema Fields based on existing Policy Specs
-func setSchemaFieldsForPolicySpec(policy *api.Policy, d *schema.ResourceData) {
+func setSchemaFieldsForPolicySpec(policy *api.Policy, d *schema.ResourceData, merge bool) {
 	specArray := make([]interface{}, 1)
 
 	specMap := make(map[string]interface{})
 
-	specMap["order"] = policy.Spec.Order
-	specMap["selector"] = policy.Spec.Selector
-
-	ingressRuleMapArray := make([]interface{}, 1)
-	if policy.Spec.IngressRules != nil && len(policy.Spec.IngressRules) > 0 {
-		resourceRules := rulesToMap(policy.Spec.IngressRules)
-		ruleMap := make(map[string]interface{})
-		ruleMap["rule"] = resourceRules
-		ingressRuleMapArray[0] = ruleMap
-	}
-	egressRuleMapArray := make([]interface{}, 1)
-	if policy.Spec.EgressRules != nil && len(policy.Spec.EgressRules) > 0 {
-		resourceRules := rulesToMap(policy.Spec.EgressRules)
-		ruleMap := make(map[string]interface{})
-		ruleMap["rule"] = resourceRules
-		egressRuleMapArray[0] = ruleMap
+	// the order of a relatively placed policy is in resolved_order
+	if !dToPolicyOrderConstraint(d).relative() {
+		specMap["order"] = managedValue(d, merge, "spec.0.order", policyOrderString(policy.Spec.Order))
 	}
-	specMap["egress"] = egressRuleMapArray
-	specMap["ingress"] = ingressRuleMapArray
+	specMap["order_after"] = d.Get("spec.0.order_after")
+	specMap["order_before"] = d.Get("spec.0.order_before")
+	specMap["selector"] = managedValue(d, merge, "spec.0.selector", policy.Spec.Selector)
+
+	ingressRuleMapArray := []interface{}{rulesToBlock(d, "spec.0.ingress.0", policy.Spec.IngressRules)}
+	egressRuleMapArray := []interface{}{rulesToBlock(d, "spec.0.egress.0", policy.Spec.EgressRules)}
+	specMap["egress"] = managedValue(d, merge, "spec.0.egress", egressRuleMapArray)
+	specMap["ingress"] = managedValue(d, merge, "spec.0.ingress", ingressRuleMapArray)
 
 	specArray[0] = specMap
 
 	d.Set("spec", specArray)
 }
 
+// merge the configured attributes of spec into an existing PolicySpec
+func mergePolicySpec(existing api.PolicySpec, spec api.PolicySpec, d *schema.ResourceData) api.PolicySpec {
+	merged := existing
+
+	if _, ok := d.GetOk("spec.0.order"); ok {
+		merged.Order = spec.Order
+	}
+	if _, ok := d.GetOk("spec.0.selector"); ok {
+		merged.Selector = spec.Selector
+	}
+	if _, ok := d.GetOk("spec.0.ingress"); ok {
+		merged.IngressRules = spec.IngressRules
+	}
+	if _, ok := d.GetOk("spec.0.egress"); ok {
+		merged.EgressRules = spec.EgressRules
+	}
+
+	return merged
+}
+
 // set Metadata based on existing Policy Metadata
 func dToPolicyMetadata(d *schema.ResourceData) api.PolicyMetadata {
 	metadata := api.PolicyMetadata{
@@ -191,42 +328,52 @@ func dToPolicyMetadata(d *schema.ResourceData) api.PolicyMetadata {
 func dToPolicySpec(d *schema.ResourceData) (api.PolicySpec, error) {
 	spec := api.PolicySpec{}
 
-	order := d.Get("spec.0.order").(float64)
-
-	spec.Order = &order
+	if v := d.Get("spec.0.order").(string); v != "" {
+		order, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return spec, fmt.Errorf("ERROR: order: %v", err)
+		}
+		spec.Order = &order
+	}
 
 	spec.Selector = d.Get("spec.0.selector").(string)
 
-	if v, ok := d.GetOk("spec.0.ingress.0.rule.#"); ok {
-		ingressRules := make([]api.Rule, v.(int))
-
-		for i := range ingressRules {
-			mapStruct := d.Get("spec.0.ingress.0.rule." + strconv.Itoa(i)).(map[string]interface{})
-
-			rule, err := resourceMapToRule(mapStruct)
-			if err != nil {
-				return spec, err
-			}
+	ingressRules, err := dToRules(d, "spec.0.ingress.0")
+	if err != nil {
+		return spec, err
+	}
+	spec.IngressRules = ingressRules
 
-			ingressRules[i] = rule
-		}
-		spec.IngressRules = ingressRules
+	egressRules, err := dToRules(d, "spec.0.egress.0")
+	if err != nil {
+		return spec, err
 	}
-	if v, ok := d.GetOk("spec.0.egress.0.rule.#"); ok {
-		egressRules := make([]api.Rule, v.(int))
+	spec.EgressRules = egressRules
 
-		for i := range egressRules {
-			mapStruct := d.Get("spec.0.egress.0.rule." + strconv.Itoa(i)).(map[string]interface{})
+	return spec, nil
+}
 
-			rule, err := resourceMapToRule(mapStruct)
-			if err != nil {
-				return spec, err
-			}
+// Policy orders are strings in the config, so that an order of 0 is told
+// apart from no order in merge mode. They're kept in state as Calico
+// formats them.
+func validatePolicyOrder(v interface{}, k string) (ws []string, es []error) {
+	if _, err := strconv.ParseFloat(v.(string), 64); err != nil {
+		es = append(es, fmt.Errorf("%s must be a number: %v", k, err))
+	}
+	return
+}
 
-			egressRules[i] = rule
-		}
-		spec.EgressRules = egressRules
+func normalizePolicyOrder(v interface{}) string {
+	order, err := strconv.ParseFloat(v.(string), 64)
+	if err != nil {
+		return v.(string)
 	}
+	return strconv.FormatFloat(order, 'f', -1, 64)
+}
 
-	return spec, nil
+func policyOrderString(order *float64) string {
+	if order == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*order, 'f', -1, 64)
 }
@@ -0,0 +1,414 @@
+package calico
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/hashcode"
+	"github.com/hashicorp/terraform/helper/mutexkv"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+)
+
+// how often a rule write is tried when its parent changes in between
+const ruleWriteAttempts = 3
+
+// rule resources of the same policy or profile take turns in their
+// read-modify-write cycles
+var ruleParentMutex = mutexkv.NewMutexKV()
+
+// ruleOwners records, per rule parent, whether its calico_policy or
+// calico_profile resource manages the rules of that direction itself. Rule
+// resources refuse such a parent, its next apply would drop their rules.
+var ruleOwners = struct {
+	sync.Mutex
+	owned map[string]bool
+}{owned: make(map[string]bool)}
+
+// registerRuleOwner records which rules the policy or profile resource in d
+// manages: all of them in replace mode, the directions it sets in merge mode
+func registerRuleOwner(d *schema.ResourceData, config config, kind string) {
+	merge := config.mergeOnUpdate(d)
+
+	ruleOwners.Lock()
+	defer ruleOwners.Unlock()
+
+	for _, direction := range []string{"ingress", "egress"} {
+		_, set := d.GetOk("spec.0." + direction)
+		parent := ruleParent{kind: kind, name: d.Get("name").(string), direction: direction}
+		ruleOwners.owned[parent.String()] = !merge || set
+	}
+}
+
+func resourceCalicoPolicyRule() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCalicoPolicyRuleCreate,
+		Read:   resourceCalicoPolicyRuleRead,
+		Update: resourceCalicoPolicyRuleUpdate,
+		Delete: resourceCalicoPolicyRuleDelete,
+
+		Schema: map[string]*schema.Schema{
+			"policy": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			"profile": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+			"direction": &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validateRuleDirection,
+			},
+			"rule": &schema.Schema{
+				Type:     schema.TypeList,
+				Required: true,
+				ForceNew: true,
+				Elem:     ruleElemSchema(),
+			},
+			"position": &schema.Schema{
+				Type:     schema.TypeInt,
+				Optional: true,
+				Default:  -1,
+			},
+			"after": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"before": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"index": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func validateRuleDirection(v interface{}, k string) (ws []string, es []error) {
+	switch v.(string) {
+	case "ingress", "egress":
+	default:
+		es = append(es, fmt.Errorf("%s must be %q or %q, got %q", k, "ingress", "egress", v))
+	}
+	return
+}
+
+// ruleHash identifies a rule by its content, rules have no name in Calico
+func ruleHash(rule api.Rule) string {
+	b, _ := json.Marshal(rule)
+	return strconv.Itoa(hashcode.String(string(b)))
+}
+
+// ruleIndex returns where the rule with hash is in rules, -1 when it's not
+func ruleIndex(rules []api.Rule, hash string) int {
+	for i, rule := range rules {
+		if ruleHash(rule) == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// ruleInsertIndex returns where a rule goes into rules: at position, next to
+// the rule with the anchor ID, or at the end
+func ruleInsertIndex(rules []api.Rule, position int, after, before string) (int, error) {
+	anchor := after
+	if before != "" {
+		anchor = before
+	}
+	if anchor != "" {
+		i := ruleIndex(rules, anchor[strings.LastIndex(anchor, "/")+1:])
+		if i < 0 {
+			return 0, fmt.Errorf("ERROR: anchor rule %s doesn't exist", anchor)
+		}
+		if after != "" {
+			i++
+		}
+		return i, nil
+	}
+
+	if position < 0 || position > len(rules) {
+		return len(rules), nil
+	}
+	return position, nil
+}
+
+// ruleParent is the policy or profile a rule resource belongs to
+type ruleParent struct {
+	kind      string
+	name      string
+	direction string
+}
+
+func dToRuleParent(d *schema.ResourceData) (ruleParent, error) {
+	parent := ruleParent{
+		direction: d.Get("direction").(string),
+	}
+
+	policy, profile := d.Get("policy").(string), d.Get("profile").(string)
+	switch {
+	case policy != "" && profile == "":
+		parent.kind, parent.name = "policy", policy
+	case profile != "" && policy == "":
+		parent.kind, parent.name = "profile", profile
+	default:
+		return parent, fmt.Errorf("ERROR: exactly one of policy and profile has to be set")
+	}
+
+	return parent, nil
+}
+
+func (p ruleParent) String() string {
+	return p.kind + "/" + p.name + "/" + p.direction
+}
+
+// checkOwner fails when the parent's own resource manages these rules
+func (p ruleParent) checkOwner() error {
+	ruleOwners.Lock()
+	defer ruleOwners.Unlock()
+
+	if ruleOwners.owned[p.String()] {
+		return fmt.Errorf("ERROR: the calico_%s resource of %s manages its %s rules itself and would drop this rule, "+
+			"leave %s unset and set update_mode = \"merge\" on it", p.kind, p.name, p.direction, p.direction)
+	}
+	return nil
+}
+
+// rules reads the rules of the parent, and returns them with a function
+// that writes them back conditional on the revision that was read
+func (p ruleParent) rules(config config) ([]api.Rule, func([]api.Rule) error, error) {
+	calicoClient, revisions := newRevisionClient(config.Client)
+	write := func(apply func() error) error {
+		if err := apply(); err != nil {
+			return revisions.conflict(err)
+		}
+		return nil
+	}
+
+	if p.kind == "policy" {
+		policy, err := calicoClient.Policies().Get(api.PolicyMetadata{Name: p.name})
+		if err != nil {
+			return nil, nil, err
+		}
+		revisions.hold()
+
+		rules := &policy.Spec.IngressRules
+		if p.direction == "egress" {
+			rules = &policy.Spec.EgressRules
+		}
+		return *rules, func(updated []api.Rule) error {
+			*rules = updated
+			config.cache.invalidate(policyCacheKey(policy.Metadata))
+			return write(func() error {
+				_, err := calicoClient.Policies().Apply(policy)
+				return err
+			})
+		}, nil
+	}
+
+	profile, err := calicoClient.Profiles().Get(api.ProfileMetadata{Name: p.name})
+	if err != nil {
+		return nil, nil, err
+	}
+	revisions.hold()
+
+	rules := &profile.Spec.IngressRules
+	if p.direction == "egress" {
+		rules = &profile.Spec.EgressRules
+	}
+	return *rules, func(updated []api.Rule) error {
+		*rules = updated
+		config.cache.invalidate(profileCacheKey(profile.Metadata))
+		return write(func() error {
+			_, err := calicoClient.Profiles().Apply(profile)
+			return err
+		})
+	}, nil
+}
+
+// modify runs a read-modify-write cycle on the rules of the parent, retried
+// when the parent changed in between
+func (p ruleParent) modify(config config, modify func([]api.Rule) ([]api.Rule, error)) error {
+	ruleParentMutex.Lock(p.kind + "/" + p.name)
+	defer ruleParentMutex.Unlock(p.kind + "/" + p.name)
+
+	for attempt := 1; ; attempt++ {
+		rules, write, err := p.rules(config)
+		if err != nil {
+			return err
+		}
+		updated, err := modify(append([]api.Rule{}, rules...))
+		if err != nil {
+			return err
+		}
+
+		err = write(updated)
+		if _, ok := err.(errors.ErrorResourceUpdateConflict); ok && attempt < ruleWriteAttempts {
+			log.Printf("[DEBUG] %s changed while its rules were written, retrying", p)
+			continue
+		}
+		return err
+	}
+}
+
+func dToRule(d *schema.ResourceData) (api.Rule, error) {
+	return resourceMapToRule(d.Get("rule.0").(map[string]interface{}))
+}
+
+func resourceCalicoPolicyRuleCreate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	parent, err := dToRuleParent(d)
+	if err != nil {
+		return err
+	}
+	if err := parent.checkOwner(); err != nil {
+		return err
+	}
+	rule, err := dToRule(d)
+	if err != nil {
+		return err
+	}
+	hash := ruleHash(rule)
+
+	err = parent.modify(config, func(rules []api.Rule) ([]api.Rule, error) {
+		if ruleIndex(rules, hash) >= 0 {
+			return nil, fmt.Errorf("ERROR: %s already has this rule", parent)
+		}
+		i, err := ruleInsertIndex(rules, d.Get("position").(int), d.Get("after").(string), d.Get("before").(string))
+		if err != nil {
+			return nil, err
+		}
+		return append(rules[:i], append([]api.Rule{rule}, rules[i:]...)...), nil
+	})
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	d.SetId(parent.String() + "/" + hash)
+	return resourceCalicoPolicyRuleRead(d, meta)
+}
+
+func resourceCalicoPolicyRuleRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	parent, err := dToRuleParent(d)
+	if err != nil {
+		return err
+	}
+	if err := parent.checkOwner(); err != nil {
+		return err
+	}
+
+	var rules []api.Rule
+	if parent.kind == "policy" {
+		var policy *api.Policy
+		policy, _, err = config.getPolicy(api.PolicyMetadata{Name: parent.name})
+		if err == nil {
+			rules = policy.Spec.IngressRules
+			if parent.direction == "egress" {
+				rules = policy.Spec.EgressRules
+			}
+		}
+	} else {
+		var profile *api.Profile
+		profile, _, err = config.getProfile(api.ProfileMetadata{Name: parent.name})
+		if err == nil {
+			rules = profile.Spec.IngressRules
+			if parent.direction == "egress" {
+				rules = profile.Spec.EgressRules
+			}
+		}
+	}
+	if err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	// the rule is gone when it was removed or changed out of band
+	i := ruleIndex(rules, d.Id()[strings.LastIndex(d.Id(), "/")+1:])
+	if i < 0 {
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("index", i)
+	if position := d.Get("position").(int); position >= 0 && position != i {
+		d.Set("position", i)
+	}
+
+	return nil
+}
+
+// Update moves the rule, its content can't change without a new rule
+func resourceCalicoPolicyRuleUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	parent, err := dToRuleParent(d)
+	if err != nil {
+		return err
+	}
+	if err := parent.checkOwner(); err != nil {
+		return err
+	}
+	hash := d.Id()[strings.LastIndex(d.Id(), "/")+1:]
+
+	err = parent.modify(config, func(rules []api.Rule) ([]api.Rule, error) {
+		current := ruleIndex(rules, hash)
+		if current < 0 {
+			return nil, fmt.Errorf("ERROR: the rule was removed from %s", parent)
+		}
+		rule := rules[current]
+		rules = append(rules[:current], rules[current+1:]...)
+
+		i, err := ruleInsertIndex(rules, d.Get("position").(int), d.Get("after").(string), d.Get("before").(string))
+		if err != nil {
+			return nil, err
+		}
+		return append(rules[:i], append([]api.Rule{rule}, rules[i:]...)...), nil
+	})
+	if err != nil {
+		return fmt.Errorf("ERROR: %v", err)
+	}
+
+	return resourceCalicoPolicyRuleRead(d, meta)
+}
+
+func resourceCalicoPolicyRuleDelete(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	parent, err := dToRuleParent(d)
+	if err != nil {
+		return err
+	}
+	hash := d.Id()[strings.LastIndex(d.Id(), "/")+1:]
+
+	err = parent.modify(config, func(rules []api.Rule) ([]api.Rule, error) {
+		if i := ruleIndex(rules, hash); i >= 0 {
+			rules = append(rules[:i], rules[i+1:]...)
+		}
+		return rules, nil
+	})
+	if err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package calico
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+func testRules() []api.Rule {
+	return []api.Rule{
+		{Action: "deny", Source: api.EntityRule{Selector: "role == 'bad'"}},
+		{Action: "allow", Source: api.EntityRule{Selector: "role == 'web'"}},
+		{Action: "allow", Source: api.EntityRule{Selector: "role == 'db'"}},
+	}
+}
+
+func TestRuleHash(t *testing.T) {
+	rules := testRules()
+
+	if ruleHash(rules[1]) != ruleHash(api.Rule{Action: "allow", Source: api.EntityRule{Selector: "role == 'web'"}}) {
+		t.Errorf("expected equal rules to have the same hash")
+	}
+	if ruleHash(rules[1]) == ruleHash(rules[2]) {
+		t.Errorf("expected rules that differ to have different hashes")
+	}
+	for i, rule := range rules {
+		if index := ruleIndex(rules, ruleHash(rule)); index != i {
+			t.Errorf("expected rule %d to be found at %d, got %d", i, i, index)
+		}
+	}
+	if index := ruleIndex(rules, ruleHash(api.Rule{Action: "log"})); index != -1 {
+		t.Errorf("expected a missing rule to be found at -1, got %d", index)
+	}
+}
+
+func TestRuleInsertIndex(t *testing.T) {
+	rules := testRules()
+	anchor := "policy/mypolicy/ingress/" + ruleHash(rules[1])
+
+	cases := []struct {
+		position      int
+		after, before string
+		expected      int
+		err           bool
+	}{
+		{-1, "", "", 3, false},
+		{0, "", "", 0, false},
+		{2, "", "", 2, false},
+		{7, "", "", 3, false},
+		{-1, anchor, "", 2, false},
+		{-1, "", anchor, 1, false},
+		// an anchor wins over the position
+		{0, anchor, "", 2, false},
+		{-1, "policy/mypolicy/ingress/123", "", 0, true},
+	}
+
+	for _, c := range cases {
+		i, err := ruleInsertIndex(rules, c.position, c.after, c.before)
+		if c.err {
+			if err == nil {
+				t.Errorf("position %d after %q before %q: expected an error, got %d", c.position, c.after, c.before, i)
+			}
+			continue
+		}
+		if err != nil || i != c.expected {
+			t.Errorf("position %d after %q before %q: expected %d, got %d (%v)", c.position, c.after, c.before, c.expected, i, err)
+		}
+	}
+}
+
+func TestRuleParent_checkOwner(t *testing.T) {
+	policySchema := resourceCalicoPolicy().Schema
+	cases := []struct {
+		name    string
+		raw     map[string]interface{}
+		ingress bool
+		egress  bool
+	}{
+		{"replace", map[string]interface{}{"name": "replace", "update_mode": "replace"}, true, true},
+		{"merge", map[string]interface{}{"name": "merge", "update_mode": "merge"}, false, false},
+		{"merge-egress", map[string]interface{}{
+			"name":        "merge-egress",
+			"update_mode": "merge",
+			"spec": []interface{}{map[string]interface{}{
+				"egress": []interface{}{map[string]interface{}{
+					"rule": []interface{}{map[string]interface{}{"action": "allow", "protocol": "tcp"}},
+				}},
+			}},
+		}, false, true},
+	}
+
+	for _, c := range cases {
+		d := schema.TestResourceDataRaw(t, policySchema, c.raw)
+		registerRuleOwner(d, config{updateMode: updateModeReplace}, "policy")
+
+		for direction, owned := range map[string]bool{"ingress": c.ingress, "egress": c.egress} {
+			err := ruleParent{kind: "policy", name: c.name, direction: direction}.checkOwner()
+			if owned && err == nil {
+				t.Errorf("%s: expected the %s rules to be refused", c.name, direction)
+			}
+			if !owned && err != nil {
+				t.Errorf("%s: %s rules: %v", c.name, direction, err)
+			}
+		}
+	}
+}
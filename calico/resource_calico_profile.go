@@ -2,7 +2,6 @@ package calico
 
 import (
 	"fmt"
-	"strconv"
 
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/projectcalico/libcalico-go/lib/api"
@@ -45,12 +44,34 @@ func resourceCalicoProfile() *schema.Resource {
 					},
 				},
 			},
+			"update_mode": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateUpdateMode(true),
+			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateAdoptExisting(true),
+			},
+			"revision": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"overwrite_on_conflict": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
 		},
 	}
 }
 
 func resourceCalicoProfileCreate(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
+	registerRuleOwner(d, config, "profile")
 	calicoClient := config.Client
 
 	metadata := dToProfileMetadata(d)
@@ -60,23 +81,60 @@ func resourceCalicoProfileCreate(d *schema.ResourceData, meta interface{}) error
 	}
 
 	profiles := calicoClient.Profiles()
+	config.cache.invalidate(profileCacheKey(metadata))
 	if _, err = profiles.Create(&api.Profile{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		if _, ok := err.(errors.ErrorResourceAlreadyExists); !ok || config.adoptMode(d) == adoptNever {
+			return err
+		}
+		if err := adoptProfile(d, config, metadata, spec); err != nil {
+			return err
+		}
 	}
 
 	d.SetId(metadata.Name)
 	return resourceCalicoProfileRead(d, meta)
 }
 
+// take over an existing Profile instead of creating it
+func adoptProfile(d *schema.ResourceData, config config, metadata api.ProfileMetadata, spec api.ProfileSpec) error {
+	calicoClient, revisions := config.conditionalClient(d)
+	profiles := calicoClient.Profiles()
+
+	existing, err := profiles.Get(metadata)
+	if err != nil {
+		return err
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+	if config.mergeOnUpdate(d) {
+		metadata.Labels = mergeLabels(existing.Metadata.Labels, d, "labels")
+		spec = mergeProfileSpec(existing.Spec, spec, d)
+	}
+
+	write, err := config.adopt(d, "profile "+metadata.Name, existing.Metadata, existing.Spec, metadata, spec)
+	if err != nil || !write {
+		return err
+	}
+
+	if _, err = profiles.Apply(&api.Profile{
+		Metadata: metadata,
+		Spec:     spec,
+	}); err != nil {
+		return revisions.conflict(err)
+	}
+
+	return nil
+}
+
 func resourceCalicoProfileRead(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	registerRuleOwner(d, config, "profile")
 
-	profiles := calicoClient.Profiles()
-	profile, err := profiles.Get(api.ProfileMetadata{
+	profile, revision, err := config.getProfile(api.ProfileMetadata{
 		Name: d.Get("name").(string),
 	})
 
@@ -91,54 +149,78 @@ func resourceCalicoProfileRead(d *schema.ResourceData, meta interface{}) error {
 	}
 
 	d.Set("name", profile.Metadata.Name)
-	d.Set("labels", profile.Metadata.Labels)
+	d.Set("labels", managedLabels(d, config.mergeOnUpdate(d), "labels", profile.Metadata.Labels))
 
-	setSchemaFieldsForProfileSpec(profile, d)
+	setSchemaFieldsForProfileSpec(profile, d, config.mergeOnUpdate(d))
+	d.Set("revision", revision)
 
 	return nil
 }
 
 func resourceCalicoProfileUpdate(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	registerRuleOwner(d, config, "profile")
+	calicoClient, revisions := config.conditionalClient(d)
 
 	profiles := calicoClient.Profiles()
 
 	metadata := dToProfileMetadata(d)
-	if _, err := profiles.Get(metadata); err != nil {
+	existing, err := profiles.Get(metadata)
+	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
 			d.SetId("")
 			return nil
 		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
 	}
 
 	spec, err := dToProfileSpec(d)
 	if err != nil {
 		return err
 	}
+	if config.mergeOnUpdate(d) {
+		metadata.Labels = mergeLabels(existing.Metadata.Labels, d, "labels")
+		spec = mergeProfileSpec(existing.Spec, spec, d)
+	}
 
+	config.cache.invalidate(profileCacheKey(metadata))
 	if _, err = profiles.Apply(&api.Profile{
 		Metadata: metadata,
 		Spec:     spec,
 	}); err != nil {
-		return err
+		return revisions.conflict(err)
 	}
 
-	return nil
+	return resourceCalicoProfileRead(d, meta)
 }
 
 func resourceCalicoProfileDelete(d *schema.ResourceData, meta interface{}) error {
 	config := meta.(config)
-	calicoClient := config.Client
+	calicoClient, revisions := config.conditionalClient(d)
 
 	profiles := calicoClient.Profiles()
-	err := profiles.Delete(api.ProfileMetadata{
+	metadata := api.ProfileMetadata{
 		Name: d.Get("name").(string),
-	})
+	}
+	if _, err := profiles.Get(metadata); err != nil {
+		if _, ok := err.(errors.ErrorResourceDoesNotExist); ok {
+			return nil
+		}
+		return fmt.Errorf("ERROR: %v", err)
+	}
+	if err := revisions.check(d); err != nil {
+		return err
+	}
+
+	config.cache.invalidate(profileCacheKey(metadata))
+	err := profiles.Delete(metadata)
 
 	if err != nil {
 		if _, ok := err.(errors.ErrorResourceDoesNotExist); !ok {
-			return fmt.Errorf("ERROR: %v", err)
+			return fmt.Errorf("ERROR: %v", revisions.conflict(err))
 		}
 	}
 
@@ -146,32 +228,34 @@ func resourceCalicoProfileDelete(d *schema.ResourceData, meta interface{}) error
 }
 
 // set Schema Fields based on existing Profile Specs
-func setSchemaFieldsForProfileSpec(profile *api.Profile, d *schema.ResourceData) {
+func setSchemaFieldsForProfileSpec(profile *api.Profile, d *schema.ResourceData, merge bool) {
 	specArray := make([]interface{}, 1)
 
 	specMap := make(map[string]interface{})
-	ingressRuleMapArray := make([]interface{}, 1)
-	if profile.Spec.IngressRules != nil && len(profile.Spec.IngressRules) > 0 {
-		resourceRules := rulesToMap(profile.Spec.IngressRules)
-		ruleMap := make(map[string]interface{})
-		ruleMap["rule"] = resourceRules
-		ingressRuleMapArray[0] = ruleMap
-	}
-	egressRuleMapArray := make([]interface{}, 1)
-	if profile.Spec.EgressRules != nil && len(profile.Spec.EgressRules) > 0 {
-		resourceRules := rulesToMap(profile.Spec.EgressRules)
-		ruleMap := make(map[string]interface{})
-		ruleMap["rule"] = resourceRules
-		egressRuleMapArray[0] = ruleMap
-	}
-	specMap["egress"] = egressRuleMapArray
-	specMap["ingress"] = ingressRuleMapArray
+	ingressRuleMapArray := []interface{}{rulesToBlock(d, "spec.0.ingress.0", profile.Spec.IngressRules)}
+	egressRuleMapArray := []interface{}{rulesToBlock(d, "spec.0.egress.0", profile.Spec.EgressRules)}
+	specMap["egress"] = managedValue(d, merge, "spec.0.egress", egressRuleMapArray)
+	specMap["ingress"] = managedValue(d, merge, "spec.0.ingress", ingressRuleMapArray)
 
 	specArray[0] = specMap
 
 	d.Set("spec", specArray)
 }
 
+// merge the configured attributes of spec into an existing ProfileSpec
+func mergeProfileSpec(existing api.ProfileSpec, spec api.ProfileSpec, d *schema.ResourceData) api.ProfileSpec {
+	merged := existing
+
+	if _, ok := d.GetOk("spec.0.ingress"); ok {
+		merged.IngressRules = spec.IngressRules
+	}
+	if _, ok := d.GetOk("spec.0.egress"); ok {
+		merged.EgressRules = spec.EgressRules
+	}
+
+	return merged
+}
+
 // set Metadata based on existing Profile Metadata
 func dToProfileMetadata(d *schema.ResourceData) api.ProfileMetadata {
 	metadata := api.ProfileMetadata{
@@ -195,36 +279,17 @@ func dToProfileMetadata(d *schema.ResourceData) api.ProfileMetadata {
 func dToProfileSpec(d *schema.ResourceData) (api.ProfileSpec, error) {
 	spec := api.ProfileSpec{}
 
-	if v, ok := d.GetOk("spec.0.ingress.0.rule.#"); ok {
-		ingressRules := make([]api.Rule, v.(int))
-
-		for i := range ingressRules {
-			mapStruct := d.Get("spec.0.ingress.0.rule." + strconv.Itoa(i)).(map[string]interface{})
-
-			rule, err := resourceMapToRule(mapStruct)
-			if err != nil {
-				return spec, err
-			}
-
-			ingressRules[i] = rule
-		}
-		spec.IngressRules = ingressRules
+	ingressRules, err := dToRules(d, "spec.0.ingress.0")
+	if err != nil {
+		return spec, err
 	}
-	if v, ok := d.GetOk("spec.0.egress.0.rule.#"); ok {
-		egressRules := make([]api.Rule, v.(int))
+	spec.IngressRules = ingressRules
 
-		for i := range egressRules {
-			mapStruct := d.Get("spec.0.egress.0.rule." + strconv.Itoa(i)).(map[string]interface{})
-
-			rule, err := resourceMapToRule(mapStruct)
-			if err != nil {
-				return spec, err
-			}
-
-			egressRules[i] = rule
-		}
-		spec.EgressRules = egressRules
+	egressRules, err := dToRules(d, "spec.0.egress.0")
+	if err != nil {
+		return spec, err
 	}
+	spec.EgressRules = egressRules
 
 	return spec, nil
 }
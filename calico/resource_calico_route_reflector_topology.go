@@ -0,0 +1,403 @@
+package calico
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/scope"
+)
+
+// node specific BGP setting that makes calico/node act as route reflector
+const rrClusterIdConfig = "rr_cluster_id"
+
+func resourceCalicoRouteReflectorTopology() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceCalicoRouteReflectorTopologyCreate,
+		Read:   resourceCalicoRouteReflectorTopologyRead,
+		Update: resourceCalicoRouteReflectorTopologyUpdate,
+		Delete: resourceCalicoRouteReflectorTopologyDelete,
+
+		Schema: map[string]*schema.Schema{
+			"name": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"reflectors": &schema.Schema{
+				Type:     schema.TypeList,
+				Required: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"client_regex": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateRegexp,
+			},
+			"clients": &schema.Schema{
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"cluster_id": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateIP,
+			},
+			"manage_mesh": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"adopt_existing": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "",
+				ValidateFunc: validateAdoptExisting(true),
+			},
+			"peers": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"drift": driftSchema(),
+		},
+	}
+}
+
+// desiredRouteReflectorPeers returns the node scoped peers of the topology:
+// every client peers with every reflector and back, and the reflectors peer
+// with each other. Nodes peer over each address family they both have. It
+// also returns the selected clients that don't get a reflector peer, because
+// BGP isn't enabled on them or they share no address family with a reflector.
+func desiredRouteReflectorPeers(d *schema.ResourceData, config config) (map[string]api.BGPPeer, []string, error) {
+	nodes, err := config.Client.Nodes().List(api.NodeMetadata{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("ERROR: %v", err)
+	}
+	byName := make(map[string]api.Node, len(nodes.Items))
+	for _, node := range nodes.Items {
+		byName[node.Metadata.Name] = node
+	}
+
+	reflectors := []api.Node{}
+	isReflector := make(map[string]bool)
+	for _, v := range d.Get("reflectors").([]interface{}) {
+		node, ok := byName[v.(string)]
+		if !ok || node.Spec.BGP == nil {
+			return nil, nil, fmt.Errorf("ERROR: route reflector %s isn't a BGP enabled node", v.(string))
+		}
+		reflectors = append(reflectors, node)
+		isReflector[node.Metadata.Name] = true
+	}
+
+	matched, err := matchNodes(d, config, "client_regex", "clients")
+	if err != nil {
+		return nil, nil, err
+	}
+	// nodes without BGP are only clients when they're selected explicitly
+	selected := d.Get("client_regex").(string) != "" || len(d.Get("clients").([]interface{})) > 0
+	clients := []api.Node{}
+	unpeered := []string{}
+	for _, node := range matched {
+		switch {
+		case isReflector[node.Metadata.Name]:
+		case node.Spec.BGP != nil:
+			clients = append(clients, node)
+		case selected:
+			unpeered = append(unpeered, node.Metadata.Name)
+		}
+	}
+
+	globalASNumber, err := config.Client.Config().GetGlobalASNumber()
+	if err != nil {
+		return nil, nil, fmt.Errorf("ERROR: %v", err)
+	}
+
+	peers := make(map[string]api.BGPPeer)
+	// peer adds the peers of from with to and returns how many there are
+	peer := func(from, to api.Node) int {
+		count := 0
+		asNumber := globalASNumber
+		if to.Spec.BGP.ASNumber != nil {
+			asNumber = *to.Spec.BGP.ASNumber
+		}
+
+		for _, addresses := range [][2]*caliconet.IPNet{
+			{from.Spec.BGP.IPv4Address, to.Spec.BGP.IPv4Address},
+			{from.Spec.BGP.IPv6Address, to.Spec.BGP.IPv6Address},
+		} {
+			if addresses[0] == nil || addresses[1] == nil {
+				continue
+			}
+			metadata := api.BGPPeerMetadata{
+				Scope:  scope.Node,
+				Node:   from.Metadata.Name,
+				PeerIP: caliconet.IP{addresses[1].IP},
+			}
+			peers[bgpPeerGroupKey(metadata)] = api.BGPPeer{
+				Metadata: metadata,
+				Spec: api.BGPPeerSpec{
+					ASNumber: asNumber,
+				},
+			}
+			count++
+		}
+		return count
+	}
+
+	for _, client := range clients {
+		count := 0
+		for _, reflector := range reflectors {
+			count += peer(client, reflector)
+			peer(reflector, client)
+		}
+		if count == 0 {
+			unpeered = append(unpeered, client.Metadata.Name)
+		}
+	}
+	for _, reflector := range reflectors {
+		for _, other := range reflectors {
+			if other.Metadata.Name != reflector.Metadata.Name {
+				peer(reflector, other)
+			}
+		}
+	}
+	sort.Strings(unpeered)
+
+	return peers, unpeered, nil
+}
+
+// unpeeredClientsError refuses to disable the mesh while clients would be
+// left without a BGP session
+func unpeeredClientsError(unpeered []string) error {
+	return fmt.Errorf("ERROR: clients %s have no route reflector peer, BGP isn't enabled on them or they share no address family with a reflector; "+
+		"not disabling the node-to-node mesh", strings.Join(unpeered, ", "))
+}
+
+// strandedNodes returns the nodes that lose their last BGP peer when the
+// managed peers that are no longer desired are removed: nodes left out of
+// the topology that keep no peer of the topology and no node scoped peer of
+// someone else
+func strandedNodes(managed []string, desired, existing map[string]api.BGPPeer) []string {
+	isManaged := make(map[string]bool, len(managed))
+	removed := make(map[string]bool)
+	for _, key := range managed {
+		isManaged[key] = true
+		if _, ok := desired[key]; ok {
+			continue
+		}
+		if _, ok := existing[key]; ok {
+			removed[bgpPeerGroupMetadata(key).Node] = true
+		}
+	}
+
+	kept := make(map[string]bool)
+	for _, peer := range desired {
+		kept[peer.Metadata.Node] = true
+	}
+	for key, peer := range existing {
+		if !isManaged[key] {
+			kept[peer.Metadata.Node] = true
+		}
+	}
+
+	stranded := []string{}
+	for node := range removed {
+		if !kept[node] {
+			stranded = append(stranded, node)
+		}
+	}
+	sort.Strings(stranded)
+
+	return stranded
+}
+
+// meshError refuses to run the topology without the node-to-node mesh while
+// nodes would be left without a BGP session
+func meshError(d *schema.ResourceData, unpeered, stranded []string) error {
+	if !d.Get("manage_mesh").(bool) {
+		return nil
+	}
+	if len(unpeered) > 0 {
+		return unpeeredClientsError(unpeered)
+	}
+	if len(stranded) > 0 {
+		return fmt.Errorf("ERROR: nodes %s would lose their last BGP peer while the node-to-node mesh is disabled; "+
+			"peer them elsewhere first, or set manage_mesh to false to enable the mesh again", strings.Join(stranded, ", "))
+	}
+	return nil
+}
+
+// enableMeshFirst tells whether an update stops managing the mesh, which
+// enables it again before any peers are removed
+func enableMeshFirst(d *schema.ResourceData) bool {
+	o, n := d.GetChange("manage_mesh")
+	return o.(bool) && !n.(bool)
+}
+
+func resourceCalicoRouteReflectorTopologyCreate(d *schema.ResourceData, meta interface{}) error {
+	d.SetId(d.Get("name").(string))
+	return resourceCalicoRouteReflectorTopologyUpdate(d, meta)
+}
+
+func resourceCalicoRouteReflectorTopologyRead(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+
+	desired, unpeered, err := desiredRouteReflectorPeers(d, config)
+	if err != nil {
+		return err
+	}
+	existing, err := existingBgpPeers(config)
+	if err != nil {
+		return err
+	}
+
+	managed, peersDrift := bgpPeersDrift(d, desired, existing)
+
+	drift := []string{}
+	if peersDrift != "" {
+		drift = append(drift, peersDrift)
+	}
+	if d.Get("manage_mesh").(bool) && len(unpeered) > 0 {
+		drift = append(drift, "clients without a reflector peer: "+strings.Join(unpeered, ", "))
+	}
+	if stranded := strandedNodes(managed, desired, existing); d.Get("manage_mesh").(bool) && len(stranded) > 0 {
+		drift = append(drift, "nodes losing their last BGP peer: "+strings.Join(stranded, ", "))
+	}
+
+	if clusterId := d.Get("cluster_id").(string); clusterId != "" {
+		for _, v := range d.Get("reflectors").([]interface{}) {
+			value, _, err := config.Client.Config().GetBGPConfig(rrClusterIdConfig, v.(string))
+			if err != nil {
+				return fmt.Errorf("ERROR: %v", err)
+			}
+			if value != clusterId {
+				drift = append(drift, fmt.Sprintf("cluster ID of %s is %q", v.(string), value))
+			}
+		}
+	}
+
+	if d.Get("manage_mesh").(bool) {
+		mesh, err := config.Client.Config().GetNodeToNodeMesh()
+		if err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+		if mesh {
+			drift = append(drift, "node-to-node mesh is enabled")
+		}
+	}
+
+	d.Set("peers", managed)
+	d.Set("drift", joinDrift(drift))
+
+	return nil
+}
+
+// Update rolls changes out so every node keeps a BGP session: reflectors get
+// their cluster ID and all new peers are created before stale peers are
+// removed, and the mesh is only disabled once the topology is complete. When
+// manage_mesh is unset the mesh is enabled again before anything else.
+func resourceCalicoRouteReflectorTopologyUpdate(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+	calicoConfig := config.Client.Config()
+
+	desired, unpeered, err := desiredRouteReflectorPeers(d, config)
+	if err != nil {
+		return err
+	}
+	existing, err := existingBgpPeers(config)
+	if err != nil {
+		return err
+	}
+	managed := []string{}
+	for _, v := range d.Get("peers").([]interface{}) {
+		managed = append(managed, v.(string))
+	}
+	if err := meshError(d, unpeered, strandedNodes(managed, desired, existing)); err != nil {
+		return err
+	}
+
+	if enableMeshFirst(d) {
+		log.Printf("[INFO] route reflector topology %s no longer manages the mesh, enabling the node-to-node mesh", d.Id())
+		if err := calicoConfig.SetNodeToNodeMesh(true); err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	clusterId := d.Get("cluster_id").(string)
+	if clusterId != "" {
+		for _, v := range d.Get("reflectors").([]interface{}) {
+			if err := calicoConfig.SetBGPConfig(rrClusterIdConfig, v.(string), clusterId); err != nil {
+				return fmt.Errorf("ERROR: %v", err)
+			}
+		}
+	}
+
+	if err := reconcileBgpPeers(d, config, desired, existing); err != nil {
+		return err
+	}
+
+	// nodes that stopped being reflectors, or all of them when the cluster ID
+	// is no longer managed, drop it once they've lost their clients
+	o, _ := d.GetChange("cluster_id")
+	if o.(string) != "" {
+		isReflector := make(map[string]bool)
+		if clusterId != "" {
+			for _, v := range d.Get("reflectors").([]interface{}) {
+				isReflector[v.(string)] = true
+			}
+		}
+		old, _ := d.GetChange("reflectors")
+		for _, v := range old.([]interface{}) {
+			if isReflector[v.(string)] {
+				continue
+			}
+			if err := calicoConfig.UnsetBGPConfig(rrClusterIdConfig, v.(string)); err != nil {
+				return fmt.Errorf("ERROR: %v", err)
+			}
+		}
+	}
+
+	if d.Get("manage_mesh").(bool) {
+		log.Printf("[INFO] route reflector topology %s is in place, disabling the node-to-node mesh", d.Id())
+		if err := calicoConfig.SetNodeToNodeMesh(false); err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	return resourceCalicoRouteReflectorTopologyRead(d, meta)
+}
+
+// Delete restores the mesh before it removes the peers of the topology
+func resourceCalicoRouteReflectorTopologyDelete(d *schema.ResourceData, meta interface{}) error {
+	config := meta.(config)
+	calicoConfig := config.Client.Config()
+
+	if d.Get("manage_mesh").(bool) {
+		log.Printf("[INFO] enabling the node-to-node mesh before removing route reflector topology %s", d.Id())
+		if err := calicoConfig.SetNodeToNodeMesh(true); err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	for _, v := range d.Get("peers").([]interface{}) {
+		if err := deleteBgpPeer(config, bgpPeerGroupMetadata(v.(string))); err != nil {
+			return fmt.Errorf("ERROR: %v", err)
+		}
+	}
+
+	if d.Get("cluster_id").(string) != "" {
+		for _, v := range d.Get("reflectors").([]interface{}) {
+			if err := calicoConfig.UnsetBGPConfig(rrClusterIdConfig, v.(string)); err != nil {
+				return fmt.Errorf("ERROR: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
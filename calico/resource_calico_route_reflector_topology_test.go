@@ -0,0 +1,119 @@
+package calico
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	tfconfig "github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	caliconet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/scope"
+)
+
+func testTopologyPeers(keys ...string) map[string]api.BGPPeer {
+	peers := make(map[string]api.BGPPeer, len(keys))
+	for _, key := range keys {
+		peers[key] = api.BGPPeer{Metadata: bgpPeerGroupMetadata(key)}
+	}
+	return peers
+}
+
+func TestStrandedNodes(t *testing.T) {
+	managed := []string{"worker-1/10.0.0.1", "worker-2/10.0.0.1", "worker-3/10.0.0.1", "rr1/10.0.1.1"}
+	desired := testTopologyPeers("worker-1/10.0.0.1", "rr1/10.0.1.1")
+	existing := testTopologyPeers("worker-1/10.0.0.1", "worker-2/10.0.0.1", "worker-3/10.0.0.1", "rr1/10.0.1.1")
+	// worker-3 has a peer of someone else, worker-4 was removed out of band
+	existing["worker-3/10.0.2.1"] = api.BGPPeer{Metadata: api.BGPPeerMetadata{
+		Scope:  scope.Node,
+		Node:   "worker-3",
+		PeerIP: caliconet.IP{net.ParseIP("10.0.2.1")},
+	}}
+	managed = append(managed, "worker-4/10.0.0.1")
+
+	expected := []string{"worker-2"}
+	if stranded := strandedNodes(managed, desired, existing); !reflect.DeepEqual(stranded, expected) {
+		t.Fatalf("expected %v, got %v", expected, stranded)
+	}
+}
+
+func TestMeshError(t *testing.T) {
+	schemaMap := resourceCalicoRouteReflectorTopology().Schema
+	raw := func(manageMesh bool) map[string]interface{} {
+		return map[string]interface{}{"name": "cluster", "reflectors": []interface{}{"rr1"}, "manage_mesh": manageMesh}
+	}
+	stranded := []string{"worker-2"}
+
+	// with the mesh managed, and so disabled, a client can't be dropped
+	if err := meshError(schema.TestResourceDataRaw(t, schemaMap, raw(true)), nil, stranded); err == nil {
+		t.Fatalf("expected an error for stranded nodes with manage_mesh")
+	}
+	if err := meshError(schema.TestResourceDataRaw(t, schemaMap, raw(true)), []string{"worker-3"}, nil); err == nil {
+		t.Fatalf("expected an error for unpeered clients with manage_mesh")
+	}
+	// without it the mesh keeps every node connected
+	if err := meshError(schema.TestResourceDataRaw(t, schemaMap, raw(false)), []string{"worker-3"}, stranded); err != nil {
+		t.Fatalf("unexpected error without manage_mesh: %v", err)
+	}
+}
+
+// testTopologyUpdate runs update on the resource data of an update of a
+// topology from state to raw config, the way Terraform does on apply
+func testTopologyUpdate(t *testing.T, state map[string]string, raw map[string]interface{}, update func(d *schema.ResourceData)) {
+	rawConfig, err := tfconfig.NewRawConfig(raw)
+	if err != nil {
+		t.Fatalf("raw config: %v", err)
+	}
+
+	r := &schema.Resource{
+		Schema: resourceCalicoRouteReflectorTopology().Schema,
+		Update: func(d *schema.ResourceData, meta interface{}) error {
+			update(d)
+			return nil
+		},
+	}
+	s := &terraform.InstanceState{ID: "cluster", Attributes: state}
+	diff, err := r.Diff(s, terraform.NewResourceConfig(rawConfig))
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if diff == nil {
+		update(r.Data(s))
+		return
+	}
+	if _, err := r.Apply(s, diff, nil); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+}
+
+func TestEnableMeshFirst(t *testing.T) {
+	cases := []struct {
+		state    string
+		config   bool
+		expected bool
+	}{
+		{"true", false, true},
+		{"false", true, false},
+		{"true", true, false},
+		{"false", false, false},
+	}
+
+	for _, c := range cases {
+		state := map[string]string{
+			"name":           "cluster",
+			"reflectors.#":   "1",
+			"reflectors.0":   "rr1",
+			"manage_mesh":    c.state,
+			"adopt_existing": "",
+		}
+		raw := map[string]interface{}{"name": "cluster", "reflectors": []interface{}{"rr1"}, "manage_mesh": c.config}
+
+		testTopologyUpdate(t, state, raw, func(d *schema.ResourceData) {
+			if enable := enableMeshFirst(d); enable != c.expected {
+				t.Errorf("manage_mesh %s -> %v: expected enableMeshFirst %v, got %v", c.state, c.config, c.expected, enable)
+			}
+		})
+	}
+}
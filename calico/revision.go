@@ -0,0 +1,153 @@
+package calico
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	"github.com/projectcalico/libcalico-go/lib/client"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+)
+
+// revisionBackend records the datastore revision of the objects read through
+// it. Once check has accepted the revision of the object read with Get, the
+// writes to that object compare-and-swap against it.
+type revisionBackend struct {
+	bapi.Client
+
+	key       model.Key
+	revision  interface{}
+	listed    map[string]interface{}
+	expected  interface{}
+	overwrite bool
+}
+
+// newRevisionClient returns a copy of calicoClient that reads and writes
+// through a new revisionBackend
+func newRevisionClient(calicoClient *client.Client) (*client.Client, *revisionBackend) {
+	revisions := &revisionBackend{
+		Client: calicoClient.Backend,
+	}
+
+	revisionClient := *calicoClient
+	revisionClient.Backend = revisions
+
+	return &revisionClient, revisions
+}
+
+// conditionalClient returns a revision client for the resource in d, which
+// writes unconditionally when overwrite_on_conflict is set
+func (c config) conditionalClient(d *schema.ResourceData) (*client.Client, *revisionBackend) {
+	calicoClient, revisions := newRevisionClient(c.Client)
+	revisions.overwrite = d.Get("overwrite_on_conflict").(bool)
+
+	return calicoClient, revisions
+}
+
+// seen returns the revision of the object read with Get
+func (b *revisionBackend) seen() string {
+	if b.revision == nil {
+		return ""
+	}
+	return fmt.Sprint(b.revision)
+}
+
+// listedRevision returns the revision of the listed object with key
+func (b *revisionBackend) listedRevision(key model.Key) string {
+	revision, ok := b.listed[key.String()]
+	if !ok || revision == nil {
+		return ""
+	}
+	return fmt.Sprint(revision)
+}
+
+// check compares the revision that was read with the one stored in state and
+// makes the following writes conditional on it
+func (b *revisionBackend) check(d *schema.ResourceData) error {
+	if b.overwrite {
+		return nil
+	}
+
+	if known := d.Get("revision").(string); known != "" && known != b.seen() {
+		return fmt.Errorf("%v was modified out of band (revision %s, expected %s), "+
+			"refresh to review the changes or set overwrite_on_conflict", b.key, b.seen(), known)
+	}
+	b.expected = b.revision
+
+	return nil
+}
+
+// hold makes the following writes conditional on the revision read with Get,
+// for read-modify-write cycles that don't keep the revision in state
+func (b *revisionBackend) hold() {
+	b.expected = b.revision
+}
+
+// conflict turns a failed compare-and-swap into a readable error
+func (b *revisionBackend) conflict(err error) error {
+	if _, ok := err.(errors.ErrorResourceUpdateConflict); ok {
+		return fmt.Errorf("%v was modified out of band while it was being written, "+
+			"refresh to review the changes or set overwrite_on_conflict", b.key)
+	}
+	return err
+}
+
+// condition sets the expected revision on writes to the object read with Get
+func (b *revisionBackend) condition(object *model.KVPair) bool {
+	if b.expected == nil || b.key == nil || object.Key.String() != b.key.String() {
+		return false
+	}
+	object.Revision = b.expected
+
+	return true
+}
+
+func (b *revisionBackend) Get(key model.Key) (*model.KVPair, error) {
+	kvp, err := b.Client.Get(key)
+	if err == nil && b.key == nil {
+		b.key = key
+		b.revision = kvp.Revision
+	}
+	return kvp, err
+}
+
+func (b *revisionBackend) List(list model.ListInterface) ([]*model.KVPair, error) {
+	kvps, err := b.Client.List(list)
+	if err == nil {
+		b.listed = make(map[string]interface{}, len(kvps))
+		for _, kvp := range kvps {
+			b.listed[kvp.Key.String()] = kvp.Revision
+		}
+	}
+	return kvps, err
+}
+
+// written moves the expected revision along with a successful conditional
+// write, so a following write to the same object doesn't conflict with it
+func (b *revisionBackend) written(kvp *model.KVPair, err error) (*model.KVPair, error) {
+	if err == nil && kvp != nil {
+		b.expected = kvp.Revision
+	}
+	return kvp, err
+}
+
+func (b *revisionBackend) Update(object *model.KVPair) (*model.KVPair, error) {
+	if b.condition(object) {
+		return b.written(b.Client.Update(object))
+	}
+	return b.Client.Update(object)
+}
+
+// Apply can't be made conditional, so conditional applies become updates
+func (b *revisionBackend) Apply(object *model.KVPair) (*model.KVPair, error) {
+	if b.condition(object) {
+		return b.written(b.Client.Update(object))
+	}
+	return b.Client.Apply(object)
+}
+
+func (b *revisionBackend) Delete(object *model.KVPair) error {
+	b.condition(object)
+	return b.Client.Delete(object)
+}
@@ -0,0 +1,145 @@
+package calico
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	bapi "github.com/projectcalico/libcalico-go/lib/backend/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/model"
+	"github.com/projectcalico/libcalico-go/lib/errors"
+)
+
+// testRevisionBackend is a datastore of a single object that rejects writes
+// conditional on an old revision, like etcd does
+type testRevisionBackend struct {
+	bapi.Client
+
+	kvp     *model.KVPair
+	written []*model.KVPair
+}
+
+func (b *testRevisionBackend) Get(key model.Key) (*model.KVPair, error) {
+	return &model.KVPair{Key: b.kvp.Key, Value: b.kvp.Value, Revision: b.kvp.Revision}, nil
+}
+
+func (b *testRevisionBackend) List(list model.ListInterface) ([]*model.KVPair, error) {
+	return []*model.KVPair{
+		{Key: model.PolicyKey{Name: "other"}, Revision: uint64(7)},
+		b.kvp,
+	}, nil
+}
+
+func (b *testRevisionBackend) Update(object *model.KVPair) (*model.KVPair, error) {
+	if object.Revision != nil && object.Revision != b.kvp.Revision {
+		return nil, errors.ErrorResourceUpdateConflict{Identifier: object.Key}
+	}
+	b.written = append(b.written, object)
+	b.kvp = &model.KVPair{Key: object.Key, Value: object.Value, Revision: b.kvp.Revision.(uint64) + 1}
+	return b.kvp, nil
+}
+
+func (b *testRevisionBackend) Apply(object *model.KVPair) (*model.KVPair, error) {
+	object.Revision = nil
+	return b.Update(object)
+}
+
+func testRevisionData(t *testing.T, revision string, overwrite bool) *schema.ResourceData {
+	return schema.TestResourceDataRaw(t, map[string]*schema.Schema{
+		"revision":              &schema.Schema{Type: schema.TypeString, Optional: true},
+		"overwrite_on_conflict": &schema.Schema{Type: schema.TypeBool, Optional: true},
+	}, map[string]interface{}{
+		"revision":              revision,
+		"overwrite_on_conflict": overwrite,
+	})
+}
+
+func testRevisions(backend *testRevisionBackend, overwrite bool) *revisionBackend {
+	return &revisionBackend{Client: backend, overwrite: overwrite}
+}
+
+func TestRevisionBackend_check(t *testing.T) {
+	key := model.PolicyKey{Name: "policy"}
+	backend := &testRevisionBackend{kvp: &model.KVPair{Key: key, Revision: uint64(3)}}
+
+	// the revision in state matches, writes are conditional on it
+	revisions := testRevisions(backend, false)
+	kvp, _ := revisions.Get(key)
+	if err := revisions.check(testRevisionData(t, "3", false)); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	if _, err := revisions.Apply(kvp); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if backend.written[0].Revision != uint64(3) {
+		t.Fatalf("expected the apply to be conditional on revision 3, got %v", backend.written[0].Revision)
+	}
+
+	// the object was modified since it was read into state
+	revisions = testRevisions(backend, false)
+	revisions.Get(key)
+	if err := revisions.check(testRevisionData(t, "3", false)); err == nil {
+		t.Fatalf("expected check to fail on revision 4 with revision 3 in state")
+	}
+
+	// overwrite_on_conflict writes unconditionally
+	revisions = testRevisions(backend, true)
+	kvp, _ = revisions.Get(key)
+	if err := revisions.check(testRevisionData(t, "3", true)); err != nil {
+		t.Fatalf("check with overwrite_on_conflict: %v", err)
+	}
+	if _, err := revisions.Apply(kvp); err != nil {
+		t.Fatalf("apply with overwrite_on_conflict: %v", err)
+	}
+	if backend.written[1].Revision != nil {
+		t.Fatalf("expected an unconditional apply, got revision %v", backend.written[1].Revision)
+	}
+}
+
+func TestRevisionBackend_conflict(t *testing.T) {
+	key := model.PolicyKey{Name: "policy"}
+	backend := &testRevisionBackend{kvp: &model.KVPair{Key: key, Revision: uint64(3)}}
+
+	revisions := testRevisions(backend, false)
+	kvp, _ := revisions.Get(key)
+	revisions.hold()
+
+	// someone else writes between the read and the write
+	backend.kvp = &model.KVPair{Key: key, Revision: uint64(4)}
+
+	_, err := revisions.Apply(kvp)
+	if _, ok := err.(errors.ErrorResourceUpdateConflict); !ok {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	if err := revisions.conflict(err); err == nil || err.Error() == "" {
+		t.Fatalf("expected a readable conflict error, got %v", err)
+	}
+
+	// a second write after a successful one is conditional on the new revision
+	revisions = testRevisions(backend, false)
+	kvp, _ = revisions.Get(key)
+	revisions.hold()
+	if _, err := revisions.Apply(kvp); err != nil {
+		t.Fatalf("first apply: %v", err)
+	}
+	if _, err := revisions.Apply(kvp); err != nil {
+		t.Fatalf("second apply: %v", err)
+	}
+}
+
+func TestRevisionBackend_listedRevision(t *testing.T) {
+	key := model.PolicyKey{Name: "policy"}
+	backend := &testRevisionBackend{kvp: &model.KVPair{Key: key, Revision: uint64(3)}}
+
+	revisions := testRevisions(backend, false)
+	revisions.List(model.PolicyListOptions{})
+
+	if revision := revisions.listedRevision(key); revision != "3" {
+		t.Fatalf("expected revision 3 for %v, got %q", key, revision)
+	}
+	if revision := revisions.listedRevision(model.PolicyKey{Name: "other"}); revision != "7" {
+		t.Fatalf("expected revision 7 for the other policy, got %q", revision)
+	}
+	if revision := revisions.listedRevision(model.PolicyKey{Name: "missing"}); revision != "" {
+		t.Fatalf("expected no revision for a policy that wasn't listed, got %q", revision)
+	}
+}
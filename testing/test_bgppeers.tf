@@ -6,3 +6,11 @@ resource "calico_bgppeer" "mybgppeer" {
     asNumber = "63400"
   }
 }
+
+resource "calico_bgppeer" "myglobalbgppeer" {
+  scope = "global"
+  peerIP = "2001:db8::1"
+  spec {
+    asNumber = "63401"
+  }
+}
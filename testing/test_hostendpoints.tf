@@ -6,3 +6,14 @@ resource "calico_hostendpoint" "myendpoint" {
   profiles = ["endpointprofile"]
   labels = { endpointlabel = "myvalue" }
 }
+
+resource "calico_hostendpoint" "myendpoint2" {
+  name = "myendpoint2"
+  node = "my-endpoint-001"
+  expected_ips = ["2001:db8::10", "10.0.0.10"]
+  ports {
+    name = "http"
+    protocol = "tcp"
+    port = 80
+  }
+}
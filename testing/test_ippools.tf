@@ -3,8 +3,16 @@ resource "calico_ippool" "myippool" {
   spec {
     ipip {
       enabled = "true"
+      mode = "cross-subnet"
     }
     nat-outgoing = "true"
     disabled = "true"
   }
 }
+
+resource "calico_ippool" "myipv6pool" {
+  cidr = "fd80:24e2:f998:72d6::/64"
+  spec {
+    nat-outgoing = "true"
+  }
+}
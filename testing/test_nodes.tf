@@ -3,8 +3,8 @@ resource "calico_node" "mynode" {
   spec {
     bgp {
       asNumber = "64512"
-      ipv4Address = "10.244.0.1"
-      ipv6Address = "2001:db8:85a3::8a2e:370:7334"
+      ipv4Address = "10.244.0.1/24"
+      ipv6Address = "2001:db8:85a3::8a2e:370:7334/64"
     }
   }
 }